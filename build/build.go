@@ -0,0 +1,183 @@
+package build
+
+import "fmt"
+import "path/filepath"
+import "strings"
+import "github.com/MerryMage/agi/lexer"
+
+////////////////////////////////////////////////////////////////////////////////
+// Context
+//   Selects which files of a package are compiled, the same way the go tool
+//   does: by file name suffix and by build constraints in the file header.
+
+type Context struct {
+	GOOS        string
+	GOARCH      string
+	Compiler    string
+	BuildTags   []string // Extra tags, as per -tags
+	ReleaseTags []string // go1.1, go1.2, ...
+}
+
+// Our synthetic target. Files named *_dotnet.go or *_cil.go, or constrained by
+// "//go:build dotnet", are only compiled by agi.
+var Default = Context{
+	GOOS:        "dotnet",
+	GOARCH:      "cil",
+	Compiler:    "agi",
+	ReleaseTags: releaseTags(21),
+}
+
+func releaseTags(minor int) []string {
+	var tags []string
+	for i := 1; i <= minor; i++ {
+		tags = append(tags, fmt.Sprintf("go1.%d", i))
+	}
+	return tags
+}
+
+// Reference: https://golang.org/src/go/build/syslist.go
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true, "js": true,
+	"linux": true, "nacl": true, "netbsd": true, "openbsd": true, "plan9": true,
+	"solaris": true, "wasip1": true, "windows": true, "zos": true,
+	"dotnet": true,
+}
+
+var unixOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true, "linux": true,
+	"netbsd": true, "openbsd": true, "solaris": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true,
+	"arm64": true, "arm64be": true, "loong64": true, "mips": true,
+	"mipsle": true, "mips64": true, "mips64le": true, "mips64p32": true,
+	"mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true,
+	"riscv": true, "riscv64": true, "s390": true, "s390x": true, "sparc": true,
+	"sparc64": true, "wasm": true,
+	"cil": true,
+}
+
+// Is tag satisfied by this context?
+func (c *Context) MatchTag(tag string) bool {
+	if tag == c.GOOS || tag == c.GOARCH || tag == c.Compiler {
+		return true
+	}
+	if tag == "unix" && unixOS[c.GOOS] {
+		return true
+	}
+	for _, t := range c.BuildTags {
+		if t == tag {
+			return true
+		}
+	}
+	for _, t := range c.ReleaseTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Does the file name's _GOOS, _GOARCH or _GOOS_GOARCH suffix match this context?
+// Files without such a suffix always match.
+func (c *Context) GoodOSArchFile(name string) bool {
+	name = filepath.Base(name)
+	if dot := strings.Index(name, "."); dot != -1 {
+		name = name[:dot]
+	}
+
+	// Before splitting, remove the leading part (which may contain underscores)
+	// so that a file called "linux.go" is not considered to be constrained.
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return true
+	}
+	name = name[i:]
+
+	l := strings.Split(name, "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+	if n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]] {
+		return c.MatchTag(l[n-2]) && c.MatchTag(l[n-1])
+	}
+	if n >= 1 && (knownOS[l[n-1]] || knownArch[l[n-1]]) {
+		return c.MatchTag(l[n-1])
+	}
+	return true
+}
+
+// Should this file be compiled in this context?
+// Files whose names begin with "_" or "." are always ignored.
+func (c *Context) MatchFile(name string, src []byte) bool {
+	base := filepath.Base(name)
+	if !strings.HasSuffix(base, ".go") || strings.HasPrefix(base, "_") || strings.HasPrefix(base, ".") {
+		return false
+	}
+	if !c.GoodOSArchFile(base) {
+		return false
+	}
+	x := ReadConstraint(src, name)
+	return x == nil || x.Eval(c.MatchTag)
+}
+
+/*
+	Only comments in the file header count as build constraints: that is,
+	line comments before the package clause which are followed by a blank line.
+	Comments immediately before the package clause are its doc comment.
+
+	If there is a //go:build line, any // +build lines are ignored.
+	Multiple // +build lines are AND'd together.
+
+	Returns nil if the file has no build constraints.
+*/
+func ReadConstraint(src []byte, fname string) Expr {
+	l := lexer.MakeLexer(lexer.NewFileSet().AddFile(fname, len(src)), src)
+
+	var goBuild Expr
+	var plusBuild Expr
+	var pendingGoBuild []lexer.Token
+	var pendingPlusBuild []lexer.Token
+
+	sawNewline := false
+	for {
+		t := l.NextToken()
+		switch t.Type {
+		case lexer.EndOfLine:
+			if sawNewline {
+				// A blank line: everything above it is in the header.
+				for _, gb := range pendingGoBuild {
+					if goBuild != nil {
+						panic(fmt.Sprintf("%s - multiple //go:build lines", l.File().Position(gb.Pos)))
+					}
+					goBuild = ParseConstraint(gb.SourceCode)
+				}
+				for _, pb := range pendingPlusBuild {
+					plusBuild = andOf(plusBuild, ParseConstraint(pb.SourceCode))
+				}
+				pendingGoBuild = nil
+				pendingPlusBuild = nil
+			}
+			sawNewline = true
+			continue
+		case lexer.LineComment:
+			if IsGoBuild(t.SourceCode) {
+				pendingGoBuild = append(pendingGoBuild, t)
+			} else if IsPlusBuild(t.SourceCode) {
+				pendingPlusBuild = append(pendingPlusBuild, t)
+			}
+		case lexer.BlockComment:
+			// skip
+		default:
+			if goBuild != nil {
+				return goBuild
+			}
+			return plusBuild
+		}
+		sawNewline = false
+	}
+}
@@ -0,0 +1,94 @@
+package build
+
+import t "testing"
+
+func assert(t *t.T, b bool) {
+	if !b {
+		t.FailNow()
+	}
+}
+
+func shouldPanic(t *t.T, f func()) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fail()
+		}
+	}()
+
+	f()
+}
+
+func matchSource(c *Context, name string, src string) bool {
+	return c.MatchFile(name, []byte(src))
+}
+
+func TestConstraintExpr(t *t.T) {
+	tags := func(tags ...string) func(string) bool {
+		return func(tag string) bool {
+			for _, t := range tags {
+				if t == tag {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	assert(t, ParseConstraint("//go:build linux").Eval(tags("linux")))
+	assert(t, !ParseConstraint("//go:build linux").Eval(tags("dotnet")))
+	assert(t, ParseConstraint("//go:build !linux && (cil || wasm)").Eval(tags("cil")))
+	assert(t, !ParseConstraint("//go:build !linux && (cil || wasm)").Eval(tags("linux", "cil")))
+	assert(t, ParseConstraint("//go:build a || b && c").String() == "a || (b && c)")
+
+	assert(t, ParseConstraint("// +build linux,amd64 dotnet").Eval(tags("dotnet")))
+	assert(t, ParseConstraint("// +build linux,amd64 dotnet").Eval(tags("linux", "amd64")))
+	assert(t, !ParseConstraint("// +build linux,amd64 dotnet").Eval(tags("linux")))
+	assert(t, ParseConstraint("// +build !windows").Eval(tags()))
+
+	assert(t, !IsGoBuild("//go:buildx"))
+	assert(t, !IsPlusBuild("// +buildx"))
+	shouldPanic(t, func() { ParseConstraint("//go:build a &&") })
+	shouldPanic(t, func() { ParseConstraint("//go:build (a") })
+	shouldPanic(t, func() { ParseConstraint("//go:build a & b") })
+	shouldPanic(t, func() { ParseConstraint("// +build !!a") })
+}
+
+func TestGoodOSArchFile(t *t.T) {
+	c := Default
+	assert(t, c.GoodOSArchFile("file.go"))
+	assert(t, c.GoodOSArchFile("linux.go"))
+	assert(t, c.GoodOSArchFile("file_dotnet.go"))
+	assert(t, c.GoodOSArchFile("file_cil.go"))
+	assert(t, c.GoodOSArchFile("file_dotnet_cil.go"))
+	assert(t, c.GoodOSArchFile("file_dotnet_test.go"))
+	assert(t, !c.GoodOSArchFile("file_linux.go"))
+	assert(t, !c.GoodOSArchFile("file_amd64.go"))
+	assert(t, !c.GoodOSArchFile("file_dotnet_amd64.go"))
+	assert(t, !c.GoodOSArchFile("file_linux_test.go"))
+}
+
+func TestMatchFile(t *t.T) {
+	c := Default
+	assert(t, matchSource(&c, "a.go", "package a\n"))
+	assert(t, !matchSource(&c, "_a.go", "package a\n"))
+	assert(t, !matchSource(&c, "a_linux.go", "package a\n"))
+
+	assert(t, matchSource(&c, "a.go", "//go:build dotnet\n\npackage a\n"))
+	assert(t, !matchSource(&c, "a.go", "//go:build !dotnet\n\npackage a\n"))
+	assert(t, matchSource(&c, "a.go", "// Copyright\n\n//go:build agi && go1.1\n\n// Package a\npackage a\n"))
+
+	// Not followed by a blank line: this is a doc comment, not a constraint.
+	assert(t, matchSource(&c, "a.go", "//go:build linux\npackage a\n"))
+	// After the package clause: not a constraint.
+	assert(t, matchSource(&c, "a.go", "package a\n\n//go:build linux\n\n"))
+
+	// Legacy constraints are AND'd, and ignored in the presence of a go:build line.
+	assert(t, !matchSource(&c, "a.go", "// +build dotnet\n// +build linux\n\npackage a\n"))
+	assert(t, matchSource(&c, "a.go", "// +build dotnet cil\n// +build !linux\n\npackage a\n"))
+	assert(t, matchSource(&c, "a.go", "//go:build dotnet\n// +build linux\n\npackage a\n"))
+
+	c.BuildTags = []string{"special"}
+	assert(t, matchSource(&c, "a.go", "//go:build special\n\npackage a\n"))
+
+	shouldPanic(t, func() { matchSource(&c, "a.go", "//go:build a\n//go:build b\n\npackage a\n") })
+}
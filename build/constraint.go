@@ -0,0 +1,242 @@
+package build
+
+import "fmt"
+import "strings"
+
+////////////////////////////////////////////////////////////////////////////////
+// Build Constraint Expressions
+//   Reference: https://golang.org/cmd/go/#hdr-Build_constraints
+
+type Expr interface {
+	String() string
+	Eval(ok func(tag string) bool) bool
+}
+
+type TagExpr struct {
+	Tag string
+}
+
+func (x TagExpr) String() string                     { return x.Tag }
+func (x TagExpr) Eval(ok func(tag string) bool) bool { return ok(x.Tag) }
+
+type NotExpr struct {
+	X Expr
+}
+
+func (x NotExpr) String() string                     { return "!" + parenthesize(x.X) }
+func (x NotExpr) Eval(ok func(tag string) bool) bool { return !x.X.Eval(ok) }
+
+type AndExpr struct {
+	X, Y Expr
+}
+
+func (x AndExpr) String() string { return parenthesize(x.X) + " && " + parenthesize(x.Y) }
+func (x AndExpr) Eval(ok func(tag string) bool) bool {
+	// Evaluate both sides so that ok sees every tag mentioned in the expression.
+	xok := x.X.Eval(ok)
+	yok := x.Y.Eval(ok)
+	return xok && yok
+}
+
+type OrExpr struct {
+	X, Y Expr
+}
+
+func (x OrExpr) String() string { return parenthesize(x.X) + " || " + parenthesize(x.Y) }
+func (x OrExpr) Eval(ok func(tag string) bool) bool {
+	xok := x.X.Eval(ok)
+	yok := x.Y.Eval(ok)
+	return xok || yok
+}
+
+func parenthesize(x Expr) string {
+	switch x.(type) {
+	case TagExpr, NotExpr:
+		return x.String()
+	}
+	return "(" + x.String() + ")"
+}
+
+func andOf(x, y Expr) Expr {
+	if x == nil {
+		return y
+	}
+	return AndExpr{x, y}
+}
+
+func orOf(x, y Expr) Expr {
+	if x == nil {
+		return y
+	}
+	return OrExpr{x, y}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Constraint Lines
+
+// Is this line a "//go:build" constraint?
+func IsGoBuild(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "//go:build") {
+		return false
+	}
+	rest := line[len("//go:build"):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+// Is this line a legacy "// +build" constraint?
+func IsPlusBuild(line string) bool {
+	if !strings.HasPrefix(line, "//") {
+		return false
+	}
+	line = strings.TrimSpace(line[len("//"):])
+	if !strings.HasPrefix(line, "+build") {
+		return false
+	}
+	rest := line[len("+build"):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+// Parses a single "//go:build" or "// +build" line into an Expr.
+func ParseConstraint(line string) Expr {
+	if IsGoBuild(line) {
+		return parseGoBuild(strings.TrimSpace(line)[len("//go:build"):])
+	} else if IsPlusBuild(line) {
+		line = strings.TrimSpace(line[len("//"):])
+		return parsePlusBuild(line[len("+build"):])
+	}
+	panic(fmt.Sprintf("not a build constraint: %q", line))
+}
+
+/*
+	+build lines are a list of space-separated options which are OR'd.
+	Each option is a list of comma-separated terms which are AND'd.
+	Each term is an alphanumeric tag, optionally preceded by a single "!".
+*/
+func parsePlusBuild(text string) Expr {
+	var x Expr
+	for _, option := range strings.Fields(text) {
+		var y Expr
+		for _, term := range strings.Split(option, ",") {
+			var z Expr
+			if strings.HasPrefix(term, "!!") || term == "!" {
+				panic(fmt.Sprintf("invalid +build term %q", term))
+			} else if strings.HasPrefix(term, "!") {
+				z = NotExpr{TagExpr{checkTag(term[1:])}}
+			} else {
+				z = TagExpr{checkTag(term)}
+			}
+			y = andOf(y, z)
+		}
+		x = orOf(x, y)
+	}
+	if x == nil {
+		panic("empty +build line")
+	}
+	return x
+}
+
+func checkTag(tag string) string {
+	if tag == "" {
+		panic("empty build tag")
+	}
+	for _, ch := range tag {
+		if !isTagChar(ch) {
+			panic(fmt.Sprintf("invalid character %q in build tag %q", ch, tag))
+		}
+	}
+	return tag
+}
+
+func isTagChar(ch rune) bool {
+	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') || ch == '_' || ch == '.'
+}
+
+/*
+	OrExpr  = AndExpr { "||" AndExpr } .
+	AndExpr = NotExpr { "&&" NotExpr } .
+	NotExpr = "!" NotExpr | "(" OrExpr ")" | tag .
+*/
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func parseGoBuild(text string) Expr {
+	p := exprParser{s: text}
+	x := p.or()
+	if p.next() != "" {
+		panic(fmt.Sprintf("unexpected %q in //go:build expression", p.next()))
+	}
+	return x
+}
+
+// Returns the next token without consuming it.
+func (p *exprParser) next() string {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return ""
+	}
+	switch p.s[p.pos] {
+	case '(', ')', '!':
+		return p.s[p.pos : p.pos+1]
+	case '&', '|':
+		if p.pos+1 < len(p.s) && p.s[p.pos+1] == p.s[p.pos] {
+			return p.s[p.pos : p.pos+2]
+		}
+		panic(fmt.Sprintf("invalid operator %q in //go:build expression", p.s[p.pos:p.pos+1]))
+	}
+	end := p.pos
+	for end < len(p.s) && isTagChar(rune(p.s[end])) {
+		end++
+	}
+	if end == p.pos {
+		panic(fmt.Sprintf("invalid character %q in //go:build expression", p.s[p.pos]))
+	}
+	return p.s[p.pos:end]
+}
+
+func (p *exprParser) consume() string {
+	tok := p.next()
+	p.pos += len(tok)
+	return tok
+}
+
+func (p *exprParser) or() Expr {
+	x := p.and()
+	for p.next() == "||" {
+		p.consume()
+		x = OrExpr{x, p.and()}
+	}
+	return x
+}
+
+func (p *exprParser) and() Expr {
+	x := p.not()
+	for p.next() == "&&" {
+		p.consume()
+		x = AndExpr{x, p.not()}
+	}
+	return x
+}
+
+func (p *exprParser) not() Expr {
+	switch tok := p.consume(); tok {
+	case "!":
+		return NotExpr{p.not()}
+	case "(":
+		x := p.or()
+		if p.consume() != ")" {
+			panic("missing ) in //go:build expression")
+		}
+		return x
+	case "":
+		panic("unexpected end of //go:build expression")
+	case ")", "&&", "||":
+		panic(fmt.Sprintf("unexpected %q in //go:build expression", tok))
+	default:
+		return TagExpr{tok}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import "encoding/json"
+import "flag"
+import "fmt"
+import "io"
+import "math/big"
+import "os"
+import "reflect"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+import "github.com/MerryMage/agi/lexer"
+import "github.com/MerryMage/agi/parser"
+
+////////////////////////////////////////////////////////////////////////////////
+// agi tokens, agi ast
+//   Dump the tokens or the syntax tree of a file (or standard input) in a
+//   machine-readable form, either JSON or S-expressions.
+//
+//   Both formats are written from the same values:
+//     - Objects, with their keys in order. An AST node has a "node" key
+//       naming its type; in S-expressions this is the head of the list.
+//     - Lists, strings, integers, booleans and null.
+//   Strings which aren't valid UTF-8, such as the value of "\xff", are
+//   written as an object with a "bytes" key listing each byte.
+//   Positions are objects of offset, line and column, ignoring //line
+//   directives. Literal values which don't fit in a JSON number (integer,
+//   float and imaginary literals) are written as strings: integers in decimal,
+//   floats as exact fractions ("1/3"). Runes are written as their code point.
+
+type object []field
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+func dumpMain(name string, args []string, dump func(file *lexer.File, src []byte) interface{}) int {
+	flags := flag.NewFlagSet("agi "+name, flag.ContinueOnError)
+	format := flags.String("format", "json", "output format: json or sexp")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (*format != "json" && *format != "sexp") || flags.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "usage: agi %s [-format json|sexp] [file]\n", name)
+		return 2
+	}
+
+	filename := "<standard input>"
+	var src []byte
+	var err error
+	if flags.NArg() == 1 {
+		filename = flags.Arg(0)
+		src, err = os.ReadFile(filename)
+	} else {
+		src, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	v, err := safeDump(dump, lexer.NewFileSet().AddFile(filename, len(src)), src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var out strings.Builder
+	if *format == "json" {
+		writeJSON(&out, v, "")
+	} else {
+		writeSexp(&out, v, "")
+	}
+	out.WriteString("\n")
+	os.Stdout.WriteString(out.String())
+	return 0
+}
+
+// Lexer and parser errors are panics.
+func safeDump(dump func(*lexer.File, []byte) interface{}, file *lexer.File, src []byte) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return dump(file, src), nil
+}
+
+func dumpTokens(file *lexer.File, src []byte) interface{} {
+	l := lexer.MakeLexer(file, src)
+	var tokens []interface{}
+	for {
+		t := l.NextToken()
+		tokens = append(tokens, tokenObject(file, t))
+		if t.Type == lexer.EndOfFile {
+			return tokens
+		}
+	}
+}
+
+func dumpAST(file *lexer.File, src []byte) interface{} {
+	l := lexer.MakeLexer(file, src)
+	p := parser.MakeParser(&l)
+	return nodeValue(file, reflect.ValueOf(p.ParseFile()))
+}
+
+func positionObject(file *lexer.File, pos lexer.Pos) interface{} {
+	if !pos.IsValid() {
+		return nil
+	}
+	p := file.PositionFor(pos, false)
+	return object{{"offset", p.Offset}, {"line", p.Line}, {"column", p.Column}}
+}
+
+func tokenObject(file *lexer.File, t lexer.Token) object {
+	o := object{
+		{"type", t.Type.String()},
+		{"text", stringValue(t.SourceCode)},
+		{"pos", positionObject(file, t.Pos)},
+		{"end", positionObject(file, t.End)},
+	}
+	if t.Payload != nil {
+		o = append(o, field{"value", payloadValue(t.Payload)})
+	}
+	return o
+}
+
+func payloadValue(payload interface{}) interface{} {
+	switch v := payload.(type) {
+	case *big.Int:
+		return v.String()
+	case *big.Rat:
+		return v.RatString()
+	case lexer.Complex:
+		return object{{"real", v.Real.RatString()}, {"imag", v.Imag.RatString()}}
+	case rune:
+		return int(v)
+	case string:
+		return stringValue(v)
+	}
+	panic(fmt.Sprintf("ICE: unknown token payload %T", payload))
+}
+
+func stringValue(s string) interface{} {
+	if utf8.ValidString(s) {
+		return s
+	}
+	bytes := []interface{}{}
+	for i := 0; i < len(s); i++ {
+		bytes = append(bytes, int(s[i]))
+	}
+	return object{{"bytes", bytes}}
+}
+
+var tokenType = reflect.TypeOf(lexer.Token{})
+
+// Converts the exported fields of AST nodes, recursively.
+func nodeValue(file *lexer.File, v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return nodeValue(file, v.Elem())
+	case reflect.Slice:
+		list := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			list = append(list, nodeValue(file, v.Index(i)))
+		}
+		return list
+	case reflect.String:
+		return stringValue(v.String())
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int:
+		return int(v.Int())
+	case reflect.Struct:
+		if v.Type() == tokenType {
+			return tokenObject(file, v.Interface().(lexer.Token))
+		}
+		o := object{{"node", v.Type().Name()}}
+		if n, ok := v.Interface().(parser.ASTNode); ok {
+			o = append(o, field{"pos", positionObject(file, n.Begin())}, field{"end", positionObject(file, n.End())})
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				o = append(o, field{f.Name, nodeValue(file, v.Field(i))})
+			}
+		}
+		return o
+	}
+	panic(fmt.Sprintf("ICE: can't dump %s", v.Type()))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Encoding
+//   Objects which only contain scalars, like positions, are written on one
+//   line; everything else is written one element per line.
+
+func (o object) isFlat() bool {
+	for _, f := range o {
+		switch f.value.(type) {
+		case object, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(out *strings.Builder, v interface{}, indent string) {
+	switch v := v.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		out.WriteString(strconv.FormatBool(v))
+	case int:
+		out.WriteString(strconv.Itoa(v))
+	case string:
+		b, _ := json.Marshal(v)
+		out.Write(b)
+	case object:
+		out.WriteString("{")
+		for i, f := range v {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			if v.isFlat() {
+				if i > 0 {
+					out.WriteString(" ")
+				}
+				writeJSON(out, f.key, "")
+				out.WriteString(": ")
+				writeJSON(out, f.value, "")
+				continue
+			}
+			out.WriteString("\n" + indent + "  ")
+			writeJSON(out, f.key, "")
+			out.WriteString(": ")
+			writeJSON(out, f.value, indent+"  ")
+		}
+		if !v.isFlat() {
+			out.WriteString("\n" + indent)
+		}
+		out.WriteString("}")
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteString("[")
+		for i, e := range v {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n" + indent + "  ")
+			writeJSON(out, e, indent+"  ")
+		}
+		out.WriteString("\n" + indent + "]")
+	default:
+		panic(fmt.Sprintf("ICE: can't encode %T", v))
+	}
+}
+
+// Objects are written as (head :key value ...), where the head is the node
+// type or, for other objects, absent. Lists are written as (value ...).
+// Booleans are t and false, so that false can be told apart from nil.
+func writeSexp(out *strings.Builder, v interface{}, indent string) {
+	switch v := v.(type) {
+	case nil:
+		out.WriteString("nil")
+	case bool:
+		if v {
+			out.WriteString("t")
+		} else {
+			out.WriteString("false")
+		}
+	case int:
+		out.WriteString(strconv.Itoa(v))
+	case string:
+		out.WriteString(strconv.Quote(v))
+	case object:
+		out.WriteString("(")
+		for i, f := range v {
+			if i == 0 && f.key == "node" {
+				out.WriteString(f.value.(string))
+				continue
+			}
+			if i > 0 && v.isFlat() {
+				out.WriteString(" ")
+			} else if i > 0 {
+				out.WriteString("\n" + indent + " ")
+			}
+			out.WriteString(":" + f.key + " ")
+			writeSexp(out, f.value, indent+" ")
+		}
+		out.WriteString(")")
+	case []interface{}:
+		out.WriteString("(")
+		for i, e := range v {
+			if i > 0 {
+				out.WriteString("\n" + indent + " ")
+			}
+			writeSexp(out, e, indent+" ")
+		}
+		out.WriteString(")")
+	default:
+		panic(fmt.Sprintf("ICE: can't encode %T", v))
+	}
+}
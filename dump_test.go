@@ -0,0 +1,64 @@
+package main
+
+import "encoding/json"
+import "strings"
+import t "testing"
+import "github.com/MerryMage/agi/lexer"
+
+const dumpSrc = "package p\n\nvar c, s = 2i, \"\\xff\"\n\nfunc f(a, b int)\n"
+
+func get(o interface{}, key string) interface{} {
+	for _, f := range o.(object) {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return "missing"
+}
+
+func dumpBoth(v interface{}) (string, string) {
+	var j, s strings.Builder
+	writeJSON(&j, v, "")
+	writeSexp(&s, v, "")
+	return j.String(), s.String()
+}
+
+func TestDumpTokens(t *t.T) {
+	tokens := dumpTokens(lexer.NewFileSet().AddFile("<test>", len(dumpSrc)), []byte(dumpSrc)).([]interface{})
+	var imag, str object
+	for _, tok := range tokens {
+		switch get(tok, "type") {
+		case "ImaginaryLiteral":
+			imag = tok.(object)
+		case "InterpretedStringLiteral":
+			str = tok.(object)
+		}
+	}
+	assert(t, get(get(imag, "value"), "real") == "0" && get(get(imag, "value"), "imag") == "2")
+	// "\xff" isn't valid UTF-8, so it's written as bytes
+	bytes := get(get(str, "value"), "bytes").([]interface{})
+	assert(t, len(bytes) == 1 && bytes[0] == 255)
+
+	js, sexp := dumpBoth(tokens)
+	var parsed []map[string]interface{}
+	assert(t, json.Unmarshal([]byte(js), &parsed) == nil && len(parsed) == len(tokens))
+	assert(t, strings.Contains(js, `"value": {"real": "0", "imag": "2"}`))
+	assert(t, strings.Contains(sexp, "(:type \"ImaginaryLiteral\""))
+	assert(t, strings.Contains(sexp, ":value (:bytes (255))"))
+}
+
+func TestDumpAST(t *t.T) {
+	file := dumpAST(lexer.NewFileSet().AddFile("<test>", len(dumpSrc)), []byte(dumpSrc))
+	decl := get(file, "Decls").([]interface{})[1]
+	assert(t, get(decl, "node") == "FuncOrMethodDecl" && get(decl, "Receiver") == nil)
+	params := get(get(get(decl, "Signature"), "Args"), "Decls").([]interface{})
+	assert(t, get(params[0], "TypeWasElided") == true && get(params[1], "TypeWasElided") == false)
+
+	js, sexp := dumpBoth(file)
+	var parsed map[string]interface{}
+	assert(t, json.Unmarshal([]byte(js), &parsed) == nil && parsed["node"] == "File")
+	// false and nil are told apart
+	assert(t, strings.Contains(sexp, ":TypeWasElided t") && strings.Contains(sexp, ":TypeWasElided false"))
+	assert(t, strings.Contains(sexp, ":Receiver nil"))
+	assert(t, strings.Contains(js, `"TypeWasElided": false`) && strings.Contains(js, `"Receiver": null`))
+}
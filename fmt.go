@@ -0,0 +1,298 @@
+package main
+
+import "bytes"
+import "flag"
+import "fmt"
+import "io"
+import "io/fs"
+import "os"
+import "path/filepath"
+import "strings"
+import "github.com/MerryMage/agi/parser"
+
+////////////////////////////////////////////////////////////////////////////////
+// agi fmt
+//   Formats Go source files, like gofmt.
+//
+//   With no paths, formats standard input to standard output. Directories are
+//   walked for .go files.
+
+type fmtOptions struct {
+	list  bool // -l: list files whose formatting differs
+	diff  bool // -d: print diffs
+	write bool // -w: write the result back to the file
+}
+
+func fmtMain(args []string) int {
+	var opts fmtOptions
+	flags := flag.NewFlagSet("agi fmt", flag.ContinueOnError)
+	flags.BoolVar(&opts.list, "l", false, "list files whose formatting differs from agi fmt's")
+	flags.BoolVar(&opts.diff, "d", false, "display diffs instead of rewriting files")
+	flags.BoolVar(&opts.write, "w", false, "write result to (source) file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	status := 0
+	if flags.NArg() == 0 {
+		if opts.write {
+			fmt.Fprintln(os.Stderr, "agi fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = fmtFile("<standard input>", src, opts, os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+		}
+		return status
+	}
+
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (path != root && !isGoFile(d)) {
+				return nil
+			}
+			src, err := os.ReadFile(path)
+			if err == nil {
+				err = fmtFile(path, src, opts, os.Stdout)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 2
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+		}
+	}
+	return status
+}
+
+func isGoFile(d fs.DirEntry) bool {
+	name := d.Name()
+	return !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".go")
+}
+
+func fmtFile(path string, src []byte, opts fmtOptions, out io.Writer) error {
+	res, err := parser.Format(path, src)
+	if err != nil {
+		if !strings.HasPrefix(err.Error(), path+":") {
+			// Not every parser error carries a position yet
+			err = fmt.Errorf("%s: %v", path, err)
+		}
+		return err
+	}
+	if bytes.Equal(src, res) {
+		if !opts.list && !opts.diff && !opts.write {
+			_, err = out.Write(res)
+		}
+		return err
+	}
+
+	if opts.list {
+		fmt.Fprintln(out, path)
+	}
+	if opts.write {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if opts.diff {
+		fmt.Fprintf(out, "diff %s.orig %s\n", path, path)
+		io.WriteString(out, unifiedDiff(path+".orig", path, src, res))
+	}
+	if !opts.list && !opts.write && !opts.diff {
+		_, err = out.Write(res)
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Diff
+//   A minimal unified diff, with three lines of context, computed from the
+//   longest common subsequence of lines.
+
+const diffContext = 3
+
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+func diffLines(a, b []string) []diffOp {
+	return appendDiff(nil, a, b)
+}
+
+// Appends the diff of a and b, using Myers' algorithm in linear space: the
+// middle of a shortest edit script is found by searching from both ends at
+// once, and each half is diffed in turn.
+func appendDiff(ops []diffOp, a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if len(a) == 0 || len(b) == 0 {
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		x, y := middleSnake(a, b)
+		ops = appendDiff(ops, a[:x], b[:y])
+		ops = appendDiff(ops, a[x:], b[y:])
+	}
+
+	for _, l := range common {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// A point on a shortest edit script from a to b, other than its ends. a and b
+// must be non-empty, and differ in their first and last lines.
+func middleSnake(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	// forward[max+k] is the furthest x reached on diagonal k = x-y from the
+	// start; backward[max+k] is the same from the end, with x and y counted
+	// backwards from n and m.
+	forward := make([]int, 2*max+2)
+	backward := make([]int, 2*max+2)
+	delta := n - m
+	odd := delta%2 != 0
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && forward[max+k-1] < forward[max+k+1] {
+				x = forward[max+k+1]
+			} else {
+				x = forward[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[max+k] = x
+			// Does this reach a path from the end on the same diagonal?
+			if kb := delta - k; odd && kb >= -(d-1) && kb <= d-1 && x+backward[max+kb] >= n {
+				return x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && backward[max+k-1] < backward[max+k+1] {
+				x = backward[max+k+1]
+			} else {
+				x = backward[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[max+k] = x
+			if kf := delta - k; !odd && kf >= -d && kf <= d && forward[max+kf]+x >= n {
+				return n - x, m - y
+			}
+		}
+	}
+	panic("ICE: no middle snake")
+}
+
+func unifiedDiff(aName, bName string, a, b []byte) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	// aLine[k] and bLine[k] are the 1-based line numbers at ops[k]
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	aLine[0], bLine[0] = 1, 1
+	for k, op := range ops {
+		aLine[k+1], bLine[k+1] = aLine[k], bLine[k]
+		if op.kind != '+' {
+			aLine[k+1]++
+		}
+		if op.kind != '-' {
+			bLine[k+1]++
+		}
+	}
+
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// Extend the hunk until there are more than 2*diffContext unchanged lines
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end += diffContext
+				if end > run {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n",
+			aLine[start], aLine[end]-aLine[start], bLine[start], bLine[end]-bLine[start])
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return out.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import "math/rand"
+import "strings"
+import t "testing"
+
+func assert(t *t.T, b bool) {
+	if !b {
+		t.FailNow()
+	}
+}
+
+// The length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] > cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLines(t *t.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(20))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+	for n := 0; n < 2000; n++ {
+		a, b := random(), random()
+		var gotA, gotB []string
+		same := 0
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind == ' ' {
+				same++
+			}
+		}
+		// The diff reproduces both sides, and is as short as possible
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") || same != lcsLength(a, b) {
+			t.Fatalf("bad diff of %q and %q", a, b)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *t.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	b := "a\nb\nc\nd\nE\nf\ng\nh\ni\n"
+	assert(t, unifiedDiff("x.orig", "x", []byte(a), []byte(b)) ==
+		"--- x.orig\n+++ x\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n")
+}
@@ -1,36 +1,71 @@
 package lexer
 
-import "io"
 import "unicode"
+import "unicode/utf8"
 import "fmt"
 import "math/big"
+import "strconv"
+import "strings"
 
 type Lexer struct {
 	// character stream
-	f   io.ByteReader
-	pos Position
-	ch  rune
+	file     *File  // receives the line table and //line directives
+	src      string // the whole file; token text and payloads are slices of this
+	offset   int    // offset of ch
+	rdOffset int    // offset of the character after ch
+	ch       rune   // 0 at end of file
 
 	// token state
-	canElideSemicolon bool
-	t                 Token // current token
+	canElideSemicolon   bool
+	blockCommentNewline bool  // the last token was a block comment containing a newline
+	t                   Token // current token
 }
 
-func MakeLexer(f io.ByteReader, fname string) Lexer {
+// file must have been added to a FileSet with size len(src).
+func MakeLexer(file *File, src []byte) Lexer {
+	if file.Size() != len(src) {
+		panic(fmt.Sprintf("ICE: file size (%d) does not match src size (%d)", file.Size(), len(src)))
+	}
 	l := Lexer{}
-	l.f = f
-	l.pos.Filename = fname
+	l.file = file
+	l.src = string(src)
 	l.nextch()
 	return l
 }
 
+func (l *Lexer) File() *File {
+	return l.file
+}
+
 func (l *Lexer) NextToken() Token {
+	l.lextoken()
+	l.t.SourceCode = l.text()
+	l.t.End = l.file.Pos(l.offset)
+	return l.t
+}
+
+// Offset of the first character of the current token.
+func (l *Lexer) start() int {
+	return l.file.Offset(l.t.Pos)
+}
+
+// The source text of the current token so far.
+func (l *Lexer) text() string {
+	return l.src[l.start():l.offset]
+}
+
+func (l *Lexer) lextoken() {
 	// Deal with whitespace and elided semicolons
 	l.skipwhitespace()
-	if l.ch == '\n' {
+	if l.ch == '\n' || l.blockCommentNewline {
 		l.t = Token{}
-		l.t.Position = l.pos
-		l.nextch() // skip over it
+		l.t.Pos = l.file.Pos(l.offset)
+		if l.blockCommentNewline {
+			// A block comment containing newlines acts like a newline
+			l.blockCommentNewline = false
+		} else {
+			l.nextch() // skip over it
+		}
 
 		if l.canElideSemicolon {
 			l.t.Type = ElidedSemicolon
@@ -39,10 +74,10 @@ func (l *Lexer) NextToken() Token {
 			l.t.Type = EndOfLine
 		}
 
-		return l.t
+		return
 	} else if l.ch == 0 {
 		l.t = Token{}
-		l.t.Position = l.pos
+		l.t.Pos = l.file.Pos(l.offset)
 
 		if l.canElideSemicolon {
 			l.t.Type = ElidedSemicolon
@@ -51,12 +86,13 @@ func (l *Lexer) NextToken() Token {
 			l.t.Type = EndOfFile
 		}
 
-		return l.t
+		return
 	}
 
 	// Deal with other things
 	l.t = Token{}
-	l.t.Position = l.pos
+	l.t.Pos = l.file.Pos(l.offset)
+	canElideSemicolon := l.canElideSemicolon
 	l.canElideSemicolon = false
 
 	ch := l.ch
@@ -75,7 +111,7 @@ func (l *Lexer) NextToken() Token {
 			l.t.Type = DefineOp
 		}
 	case '.':
-		if isdigit(l.ch) {
+		if isdecimaldigit(l.ch) {
 			l.lexnumerical(ch)
 		} else {
 			l.t.Type = Dot
@@ -185,6 +221,8 @@ func (l *Lexer) NextToken() Token {
 		} else if l.maybech('&') {
 			l.t.Type = LogicAndOp
 		}
+	case '~':
+		l.t.Type = TildeOp
 	case '|':
 		l.t.Type = BitOrrOp
 		if l.maybech('=') {
@@ -196,11 +234,10 @@ func (l *Lexer) NextToken() Token {
 		switch {
 		case isletter(ch):
 			l.lexidentifierorkeyword()
-		case ishexdigit(ch):
+		case isdecimaldigit(ch):
 			l.lexnumerical(ch)
 		default:
-			fmt.Printf("%x %c\n", ch, ch)
-			panic("Illegal character")
+			l.errorAt(l.start(), fmt.Sprintf("illegal character %#U", ch))
 		}
 	}
 
@@ -215,69 +252,37 @@ func (l *Lexer) NextToken() Token {
 		IncrementOp, DecrementOp,
 		RParen, RBracket, RBrace:
 		l.canElideSemicolon = true
+	case LineComment, BlockComment:
+		// Comments don't affect whether the next newline is a semicolon
+		l.canElideSemicolon = canElideSemicolon
 	}
 
-	return l.t
-}
-
-func (l *Lexer) nextbyte() uint8 {
-	b, err := l.f.ReadByte()
-	if err != nil {
-		return 0
-	}
-	return b
 }
 
 // Get next unicode codepoint (decodes UTF-8)
 // Reference: https://golang.org/ref/spec#Source_code_representation
 func (l *Lexer) nextch() {
-	l.t.SourceCode += string(l.ch)
-
-	b := l.nextbyte()
-
-	var ret rune
-
-	// Unicode continuation byte : 0b10xxxxxx
-	nextContByte := func() {
-		ret <<= 6
-		b = l.nextbyte()
-		if b&0xC0 != 0x80 {
-			if b == 0 {
-				println("Unexpected EOF while in the middle of a UTF-8 codepoint")
-			} else {
-				panic("Invalid UTF-8")
-			}
-		}
-		ret |= rune(b & 0x3F)
+	if l.ch == '\n' {
+		l.file.AddLine(l.rdOffset)
 	}
+	l.offset = l.rdOffset
 
-	switch {
-	case b&0x80 == 0: // One byte sequence      : 0b0xxxxxxx
-		ret = rune(b)
-	case b&0xE0 == 0xC0: // Two byte sequence   : 0b110xxxxx
-		ret = rune(b & 0x1F)
-		nextContByte()
-	case b&0xF0 == 0xE0: // Three byte sequence : 0b1110xxxx
-		ret = rune(b & 0x0F)
-		nextContByte()
-		nextContByte()
-	case b&0xF8 == 0xF0: // Four byte sequence  : 0b11110xxx
-		ret = rune(b & 0x07)
-		nextContByte()
-		nextContByte()
-		nextContByte()
-	default:
-		panic("Invalid UTF-8")
+	if l.rdOffset >= len(l.src) {
+		l.ch = 0
+		return
 	}
 
-	if l.ch == 0x000A {
-		l.pos.Line++
-		l.pos.Column = 1
-		l.ch = ret
-	} else {
-		l.pos.Column++
-		l.ch = ret
+	r, size := rune(l.src[l.rdOffset]), 1
+	if r == 0 {
+		l.errorAt(l.offset, "illegal character NUL")
+	} else if r >= utf8.RuneSelf {
+		r, size = utf8.DecodeRuneInString(l.src[l.rdOffset:])
+		if r == utf8.RuneError && size == 1 {
+			l.errorAt(l.offset, "invalid UTF-8 encoding")
+		}
 	}
+	l.rdOffset += size
+	l.ch = r
 }
 
 // Reference: https://golang.org/ref/spec#Letters_and_digits
@@ -332,6 +337,10 @@ func (l *Lexer) maybech(r rune) bool {
 	return false
 }
 
+func (l *Lexer) errorAt(offset int, msg string) {
+	panic(fmt.Sprintf("%s - %s", l.file.Position(l.file.Pos(offset)), msg))
+}
+
 func (l *Lexer) expectch(r rune, panicstr string) {
 	if l.ch != r {
 		panic(panicstr)
@@ -343,106 +352,226 @@ func (l *Lexer) lexidentifierorkeyword() {
 	for isletter(l.ch) || isdigit(l.ch) {
 		l.nextch()
 	}
-	if keywordMap[l.t.SourceCode] != 0 {
-		l.t.Type = keywordMap[l.t.SourceCode]
+	text := l.text()
+	if keywordMap[text] != 0 {
+		l.t.Type = keywordMap[text]
 	} else {
 		l.t.Type = Identifier
-		l.t.Payload = l.t.SourceCode
+		l.t.Payload = text
 	}
 }
 
 /* Reference: https://golang.org/ref/spec#Integer_literals
-int_lit     = decimal_lit | octal_lit | hex_lit .
-decimal_lit = ( "1" … "9" ) { decimal_digit } .
-octal_lit   = "0" { octal_digit } .
-hex_lit     = "0" ( "x" | "X" ) hex_digit { hex_digit } .
+int_lit        = decimal_lit | binary_lit | octal_lit | hex_lit .
+decimal_lit    = "0" | ( "1" … "9" ) [ [ "_" ] decimal_digits ] .
+binary_lit     = "0" ( "b" | "B" ) [ "_" ] binary_digits .
+octal_lit      = "0" [ "o" | "O" ] [ "_" ] octal_digits .
+hex_lit        = "0" ( "x" | "X" ) [ "_" ] hex_digits .
+
+Reference: https://golang.org/ref/spec#Floating-point_literals
+float_lit         = decimal_float_lit | hex_float_lit .
+decimal_float_lit = decimal_digits "." [ decimal_digits ] [ decimal_exponent ] |
+                    decimal_digits decimal_exponent |
+                    "." decimal_digits [ decimal_exponent ] .
+decimal_exponent  = ( "e" | "E" ) [ "+" | "-" ] decimal_digits .
+hex_float_lit     = "0" ( "x" | "X" ) hex_mantissa hex_exponent .
+hex_mantissa      = [ "_" ] hex_digits "." [ hex_digits ] |
+                    [ "_" ] hex_digits |
+                    "." hex_digits .
+hex_exponent      = ( "p" | "P" ) [ "+" | "-" ] decimal_digits .
+
+Reference: https://golang.org/ref/spec#Imaginary_literals
+imaginary_lit = (decimal_digits | int_lit | float_lit) "i" .
+
+ch is the first character of the literal, and has already been consumed.
 */
 func (l *Lexer) lexnumerical(ch rune) {
-	switch ch {
-	case '0':
-		if l.maybech('x') || l.maybech('X') {
-			// Hex
-			l.t.Type = HexIntegerLiteral
-			for ishexdigit(l.ch) {
-				l.nextch()
-			}
-		} else if l.maybech('b') || l.maybech('B') {
-			// Binary
-			l.t.Type = BinaryIntegerLiteral
-			for l.ch == '0' || l.ch == '1' {
-				l.nextch()
-			}
-		} else {
-			// Octal
-			l.t.Type = OctalIntegerLiteral
-			for isoctaldigit(l.ch) {
-				l.nextch()
+	base := 10
+	prefix := rune(0) // 0 (decimal), '0' (legacy octal), 'x', 'o' or 'b'
+	hasDigits := false
+
+	// Integer part
+	if ch != '.' {
+		hasDigits = true
+		if ch == '0' {
+			switch {
+			case l.maybech('x') || l.maybech('X'):
+				base, prefix, hasDigits = 16, 'x', false
+			case l.maybech('o') || l.maybech('O'):
+				base, prefix, hasDigits = 8, 'o', false
+			case l.maybech('b') || l.maybech('B'):
+				base, prefix, hasDigits = 2, 'b', false
+			default:
+				base, prefix = 8, '0'
 			}
 		}
-		value, success := (&big.Int{}).SetString(l.t.SourceCode, 0)
-		if value == nil || !success {
-			panic("ICE: Could not parse verified integer literal")
+		hasDigits = l.lexdigits(base) || hasDigits
+	}
+
+	// Fractional part
+	isFloat := false
+	if dot := l.offset; ch == '.' || l.maybech('.') {
+		isFloat = true
+		if prefix == 'o' || prefix == 'b' {
+			l.errorAt(dot, "invalid radix point in "+litname(prefix))
 		}
-		l.t.Payload = value
-	case '.':
-		l.lexfloat(ch)
-	default:
-		for isdecimaldigit(l.ch) {
-			l.nextch()
+		hasDigits = l.lexdigits(base) || hasDigits
+	}
+
+	if !hasDigits {
+		l.errorAt(l.offset, litname(prefix)+" has no digits")
+	}
+
+	// Exponent
+	if e := l.ch; e == 'e' || e == 'E' || e == 'p' || e == 'P' {
+		if (e == 'e' || e == 'E') && prefix != 0 && prefix != '0' {
+			l.errorAt(l.offset, fmt.Sprintf("%q exponent requires decimal mantissa", e))
+		} else if (e == 'p' || e == 'P') && prefix != 'x' {
+			l.errorAt(l.offset, fmt.Sprintf("%q exponent requires hexadecimal mantissa", e))
 		}
-		if l.maybech('.') {
-			l.lexfloat('.')
-		} else if l.maybech('e') || l.maybech('E') {
-			l.lexfloat('e')
-		} else {
-			// Decimal
-			l.t.Type = DecimalIntegerLiteral
-			value, success := (&big.Int{}).SetString(l.t.SourceCode, 0)
-			if value == nil || !success {
-				panic("ICE: Could not parse verified integer literal")
-			}
-			l.t.Payload = value
+		l.nextch()
+		isFloat = true
+		if !l.maybech('-') {
+			l.maybech('+')
+		}
+		if !l.lexdigits(10) {
+			l.errorAt(l.offset, "exponent has no digits")
 		}
+	} else if prefix == 'x' && isFloat {
+		l.errorAt(l.offset, "hexadecimal mantissa requires a 'p' exponent")
 	}
-}
 
-/* Reference: https://golang.org/ref/spec#Floating-point_literals
-float_lit = decimals "." [ decimals ] [ exponent ] |
-            decimals exponent |
-            "." decimals [ exponent ] .
-decimals  = decimal_digit { decimal_digit } .
-exponent  = ( "e" | "E" ) [ "+" | "-" ] decimals .
-*/
-func (l *Lexer) lexfloat(ch rune) {
-	switch ch {
-	case '.':
-		if l.t.SourceCode == "" && !isdecimaldigit(l.ch) {
-			panic("expecting at least one decimal digit")
+	// Imaginary suffix
+	isImaginary := l.maybech('i')
+
+	lit := l.text()
+	switch {
+	case isImaginary:
+		l.t.Type = ImaginaryLiteral
+	case isFloat:
+		l.t.Type = FloatLiteral
+	case prefix == 'x':
+		l.t.Type = HexIntegerLiteral
+	case prefix == 'o' || prefix == '0':
+		l.t.Type = OctalIntegerLiteral
+	case prefix == 'b':
+		l.t.Type = BinaryIntegerLiteral
+	default:
+		l.t.Type = DecimalIntegerLiteral
+	}
+
+	// Only integer literals are restricted to the digits of their base:
+	// 09.5 and 09i are decimal, for backwards compatibility.
+	if !isFloat && !isImaginary && base < 10 {
+		start := 2
+		if prefix == '0' {
+			start = 1
 		}
-		for isdecimaldigit(l.ch) {
-			l.nextch()
+		for i, d := range lit[start:] {
+			if isdecimaldigit(d) && int(d-'0') >= base {
+				l.errorAt(l.start()+start+i, fmt.Sprintf("invalid digit %q in %s", d, litname(prefix)))
+			}
 		}
-		if !l.maybech('e') && !l.maybech('E') {
-			break
+	}
+	if i := invalidSeparator(lit); i >= 0 {
+		l.errorAt(l.start()+i, "'_' must separate successive digits")
+	}
+
+	value := strings.Replace(lit, "_", "", -1)
+	switch l.t.Type {
+	case ImaginaryLiteral:
+		imag, success := (&big.Rat{}).SetString(strings.TrimSuffix(value, "i"))
+		if imag == nil || !success {
+			panic("ICE: Could not parse verified imaginary literal")
+		}
+		l.t.Payload = Complex{Real: &big.Rat{}, Imag: imag}
+	case FloatLiteral:
+		f, success := (&big.Rat{}).SetString(value)
+		if f == nil || !success {
+			panic("ICE: Could not parse verified float literal")
+		}
+		l.t.Payload = f
+	default:
+		i, success := (&big.Int{}).SetString(value, 0)
+		if i == nil || !success {
+			panic("ICE: Could not parse verified integer literal")
 		}
-		fallthrough
-	case 'e':
-		if !l.maybech('-') {
-			l.maybech('+')
+		l.t.Payload = i
+	}
+}
+
+// The payload of an ImaginaryLiteral. Real is always zero.
+type Complex struct {
+	Real *big.Rat
+	Imag *big.Rat
+}
+
+// Consumes { digit | "_" }. If base <= 10, any decimal digit is accepted here;
+// digits invalid for the base are diagnosed later.
+// Returns true if there was at least one digit.
+func (l *Lexer) lexdigits(base int) bool {
+	hasDigits := false
+	for {
+		switch {
+		case l.ch == '_':
+		case base <= 10 && isdecimaldigit(l.ch), base == 16 && ishexdigit(l.ch):
+			hasDigits = true
+		default:
+			return hasDigits
 		}
-		if !isdecimaldigit(l.ch) {
-			panic("expecting at least one decimal digit")
+		l.nextch()
+	}
+}
+
+func litname(prefix rune) string {
+	switch prefix {
+	case 'x':
+		return "hexadecimal literal"
+	case 'o', '0':
+		return "octal literal"
+	case 'b':
+		return "binary literal"
+	}
+	return "decimal literal"
+}
+
+// Returns the index of the first "_" in lit which isn't between two digits
+// (a base prefix counts as a digit), or -1 if they're all fine.
+func invalidSeparator(lit string) int {
+	hex := false
+	prev := '.' // '0' for a digit, '_' for a separator, '.' for anything else
+	i := 0
+	if len(lit) >= 2 && lit[0] == '0' {
+		switch lit[1] {
+		case 'x', 'X':
+			hex = true
+			prev, i = '0', 2
+		case 'o', 'O', 'b', 'B':
+			prev, i = '0', 2
 		}
-		for isdecimaldigit(l.ch) {
-			l.nextch()
+	}
+
+	for ; i < len(lit); i++ {
+		ch := rune(lit[i])
+		switch {
+		case ch == '_':
+			if prev != '0' {
+				return i
+			}
+			prev = '_'
+		case isdecimaldigit(ch) || (hex && ishexdigit(ch)):
+			prev = '0'
+		default:
+			if prev == '_' {
+				return i - 1
+			}
+			prev = '.'
 		}
 	}
-	l.t.Type = FloatLiteral
-	value, success := (&big.Rat{}).SetString(l.t.SourceCode)
-	if value == nil || !success {
-		panic("ICE: Could not parse verified float literal")
+	if prev == '_' {
+		return len(lit) - 1
 	}
-	l.t.Payload = value
+	return -1
 }
 
 /* Reference: https://golang.org/ref/spec#Rune_literals
@@ -457,8 +586,9 @@ big_u_value      = `\` "U" hex_digit hex_digit hex_digit hex_digit
 escaped_char     = `\` ( "a" | "b" | "f" | "n" | "r" | "t" | "v" | `\` | "'" | `"` ) .
 
 This func implements ( unicode_value | byte_value ).
+isByte is true for a byte_value, which is a single byte in a string.
 */
-func (l *Lexer) lexsingletransch() rune {
+func (l *Lexer) lexsingletransch() (value rune, isByte bool) {
 	hexdigits := func(n int) rune {
 		var value rune
 		for i := 0; i < n; i++ {
@@ -486,11 +616,11 @@ func (l *Lexer) lexsingletransch() rune {
 		l.nextch()
 		switch ch {
 		case 'x':
-			return hexdigits(2)
+			return hexdigits(2), true
 		case 'u':
-			return hexdigits(4)
+			return hexdigits(4), false
 		case 'U':
-			return hexdigits(8)
+			return hexdigits(8), false
 		case '0', '1', '2', '3', '4', '5', '6', '7':
 			ch2 := l.ch
 			l.nextch()
@@ -499,32 +629,36 @@ func (l *Lexer) lexsingletransch() rune {
 			if !isoctaldigit(ch2) || !isoctaldigit(ch3) {
 				panic("too few octal digits")
 			}
-			return (ch-'0')*64 + (ch2-'0')*8 + (ch3-'0')*1
+			value := (ch-'0')*64 + (ch2-'0')*8 + (ch3-'0')*1
+			if value > 0xFF {
+				panic("octal escape value > 255")
+			}
+			return value, true
 		case 'a':
-			return 0x0007
+			return 0x0007, false
 		case 'b':
-			return 0x0008
+			return 0x0008, false
 		case 'f':
-			return 0x000C
+			return 0x000C, false
 		case 'n':
-			return 0x000A
+			return 0x000A, false
 		case 'r':
-			return 0x000D
+			return 0x000D, false
 		case 't':
-			return 0x0009
+			return 0x0009, false
 		case 'v':
-			return 0x000B
+			return 0x000B, false
 		case '\\':
-			return 0x005C
+			return 0x005C, false
 		case '\'':
-			return 0x0027
+			return 0x0027, false
 		case '"':
-			return 0x0022
+			return 0x0022, false
 		}
 	case '\n':
 		panic("Newline in the middle of a string/rune constant")
 	default:
-		return ch
+		return ch, false
 	}
 
 	panic("ICE: Unreachable")
@@ -532,39 +666,73 @@ func (l *Lexer) lexsingletransch() rune {
 
 func (l *Lexer) lexchar() {
 	l.t.Type = RuneLiteral
-	var value rune = l.lexsingletransch()
+	value, _ := l.lexsingletransch()
 	l.expectch('\'', "Expected '; only single character rune literals are allowed")
 	l.t.Payload = value
 }
 
 func (l *Lexer) lextranslatedstr() {
 	l.t.Type = InterpretedStringLiteral
-	var value string
+	start := l.offset
+	var value []byte // Stays nil unless there are escapes
 	for l.ch != '"' {
-		value += string(l.lexsingletransch())
+		if l.ch == 0 || l.ch == '\n' {
+			l.errorAt(l.start(), "string literal not terminated")
+		}
+		if value == nil && l.ch != '\\' {
+			l.nextch()
+			continue
+		}
+		if value == nil {
+			value = append([]byte{}, l.src[start:l.offset]...)
+		}
+		if ch, isByte := l.lexsingletransch(); isByte {
+			value = append(value, byte(ch))
+		} else {
+			value = utf8.AppendRune(value, ch)
+		}
 	}
+	end := l.offset
 	l.nextch()
-	l.t.Payload = value
+	if value == nil {
+		l.t.Payload = l.src[start:end]
+	} else {
+		l.t.Payload = string(value)
+	}
 }
 
 func (l *Lexer) lexrawstr() {
 	l.t.Type = RawStringLiteral
-	var value string
+	start := l.offset
 	for l.ch != '`' {
-		value += string(l.ch)
+		if l.ch == 0 {
+			l.errorAt(l.start(), "raw string literal not terminated")
+		}
 		l.nextch()
 	}
+	value := l.src[start:l.offset]
 	l.nextch()
+	// Carriage returns are discarded from raw strings
+	if strings.IndexByte(value, '\r') != -1 {
+		value = strings.Replace(value, "\r", "", -1)
+	}
 	l.t.Payload = value
 }
 
 func (l *Lexer) lexcomment() {
 	if l.ch == '/' {
 		l.t.Type = LineComment
-		for l.ch != '\n' {
+		for l.ch != '\n' && l.ch != 0 {
 			l.nextch()
 		}
 		// !! Do not consume newline
+		// A //line directive must start at the beginning of a line, and
+		// applies from the start of the next line.
+		if start := l.start(); start == 0 || l.src[start-1] == '\n' {
+			if text := l.text(); strings.HasPrefix(text, "//line ") {
+				l.lexlinedirective(text[len("//line "):], l.offset+1)
+			}
+		}
 	} else {
 		hasNewline := false
 		l.t.Type = BlockComment
@@ -573,6 +741,8 @@ func (l *Lexer) lexcomment() {
 			for l.ch != '*' {
 				if l.ch == '\n' {
 					hasNewline = true
+				} else if l.ch == 0 {
+					l.errorAt(l.start(), "comment not terminated")
 				}
 				l.nextch()
 			}
@@ -581,10 +751,51 @@ func (l *Lexer) lexcomment() {
 				break
 			}
 		}
-		if hasNewline {
-			l.ch = '\n'
-		} else {
-			l.nextch()
+		l.nextch()
+		l.blockCommentNewline = hasNewline
+		// A /*line*/ directive applies from the character following it.
+		if text := l.text(); strings.HasPrefix(text, "/*line ") {
+			l.lexlinedirective(text[len("/*line "):len(text)-len("*/")], l.offset)
 		}
 	}
 }
+
+/* Reference: https://golang.org/cmd/compile/#hdr-Compiler_Directives
+	//line :line
+	//line :line:col
+	//line filename:line
+	//line filename:line:col
+
+The same forms are also allowed in block comments starting with "/*line ".
+The character at offset next is at the given position. An empty filename means
+the filename is unchanged. Comments which don't end in :line are not directives.
+*/
+func (l *Lexer) lexlinedirective(text string, next int) {
+	colon := strings.LastIndexByte(text, ':')
+	if colon < 0 {
+		return
+	}
+	line, err := strconv.Atoi(text[colon+1:])
+	if err != nil {
+		return
+	}
+	filename, column := text[:colon], 0
+	if colon := strings.LastIndexByte(filename, ':'); colon >= 0 {
+		if n, err := strconv.Atoi(filename[colon+1:]); err == nil {
+			filename, line, column = filename[:colon], n, line
+			if column <= 0 {
+				l.errorAt(l.start(), "invalid column number in line directive")
+			}
+		}
+	}
+	if line <= 0 {
+		l.errorAt(l.start(), "invalid line number in line directive")
+	}
+	if filename == "" {
+		filename = l.file.Position(l.t.Pos).Filename
+	}
+	if next > len(l.src) {
+		return // Nothing follows it
+	}
+	l.file.AddLineColumnInfo(next, filename, line, column)
+}
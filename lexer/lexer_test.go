@@ -0,0 +1,209 @@
+package lexer
+
+import "fmt"
+import "math/big"
+import "strings"
+import t "testing"
+
+func makeTestLexer(s string) Lexer {
+	return MakeLexer(NewFileSet().AddFile("<test>", len(s)), []byte(s))
+}
+
+func lexOne(s string) Token {
+	l := makeTestLexer(s)
+	return l.NextToken()
+}
+
+func assert(t *t.T, b bool) {
+	if !b {
+		t.FailNow()
+	}
+}
+
+func shouldPanicWith(t *t.T, substr string, f func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("expected panic containing %q", substr)
+		} else if s, ok := r.(string); !ok || !strings.Contains(s, substr) {
+			t.Errorf("expected panic containing %q, got %v", substr, r)
+		}
+	}()
+
+	f()
+}
+
+func TestIntegerLiterals(t *t.T) {
+	check := func(s string, tt TokenType, value int64) {
+		tok := lexOne(s)
+		if tok.Type != tt || tok.SourceCode != s || tok.Payload.(*big.Int).Cmp(big.NewInt(value)) != 0 {
+			t.Errorf("%s: got %v %q %v", s, tok.Type, tok.SourceCode, tok.Payload)
+		}
+	}
+
+	check("42", DecimalIntegerLiteral, 42)
+	check("4_2", DecimalIntegerLiteral, 42)
+	check("0", OctalIntegerLiteral, 0)
+	check("0600", OctalIntegerLiteral, 0600)
+	check("0_600", OctalIntegerLiteral, 0600)
+	check("0o600", OctalIntegerLiteral, 0600)
+	check("0O600", OctalIntegerLiteral, 0600)
+	check("0xBadFace", HexIntegerLiteral, 0xBadFace)
+	check("0x_67_7a_2f_cc_40_c6", HexIntegerLiteral, 0x677a2fcc40c6)
+	check("0b1011", BinaryIntegerLiteral, 11)
+	check("0B_1_0", BinaryIntegerLiteral, 2)
+
+	big := lexOne("170141183460469231731687303715884105727").Payload.(*big.Int)
+	assert(t, big.String() == "170141183460469231731687303715884105727")
+}
+
+func TestFloatLiterals(t *t.T) {
+	check := func(s string, value string) {
+		tok := lexOne(s)
+		want, _ := (&big.Rat{}).SetString(value)
+		if tok.Type != FloatLiteral || tok.SourceCode != s || tok.Payload.(*big.Rat).Cmp(want) != 0 {
+			t.Errorf("%s: got %v %q %v", s, tok.Type, tok.SourceCode, tok.Payload)
+		}
+	}
+
+	check("0.", "0")
+	check("72.40", "72.4")
+	check("072.40", "72.4")
+	check("2.71828", "2.71828")
+	check("1.e+0", "1")
+	check("6.67428e-11", "6.67428e-11")
+	check("1E6", "1000000")
+	check(".25", "0.25")
+	check(".12345E+5", "12345")
+	check("1_5.", "15")
+	check("0.15e+0_2", "15")
+	check("09.5", "9.5")
+	check("0x1p-2", "0.25")
+	check("0x2.p10", "2048")
+	check("0x1.Fp+0", "1.9375")
+	check("0X.8p-0", "0.5")
+	check("0X_1FFFP-16", "0.1249847412109375")
+}
+
+func TestImaginaryLiterals(t *t.T) {
+	check := func(s string, value string) {
+		tok := lexOne(s)
+		want, _ := (&big.Rat{}).SetString(value)
+		if tok.Type != ImaginaryLiteral || tok.SourceCode != s {
+			t.Errorf("%s: got %v %q", s, tok.Type, tok.SourceCode)
+			return
+		}
+		c := tok.Payload.(Complex)
+		if c.Real.Sign() != 0 || c.Imag.Cmp(want) != 0 {
+			t.Errorf("%s: got %v", s, c)
+		}
+	}
+
+	check("0i", "0")
+	check("0123i", "123") // decimal, for backwards compatibility
+	check("0o123i", "83")
+	check("0xabci", "2748")
+	check("0b101i", "5")
+	check("0.i", "0")
+	check("2.71828i", "2.71828")
+	check("1.e+0i", "1")
+	check("6.67428e-11i", "6.67428e-11")
+	check(".12345E+5i", "12345")
+	check("0x1p-2i", "0.25")
+}
+
+func TestMalformedNumericLiterals(t *t.T) {
+	shouldPanicWith(t, "<test>:1:2 - invalid digit '9' in octal literal", func() { lexOne("09") })
+	shouldPanicWith(t, "invalid digit '8' in octal literal", func() { lexOne("0o18") })
+	shouldPanicWith(t, "invalid digit '2' in binary literal", func() { lexOne("0b102") })
+	shouldPanicWith(t, "hexadecimal literal has no digits", func() { lexOne("0x") })
+	shouldPanicWith(t, "binary literal has no digits", func() { lexOne("0b_") })
+	shouldPanicWith(t, "invalid radix point in octal literal", func() { lexOne("0o1.5") })
+	shouldPanicWith(t, "invalid radix point in binary literal", func() { lexOne("0b1.0") })
+	shouldPanicWith(t, "hexadecimal mantissa requires a 'p' exponent", func() { lexOne("0x1.5") })
+	shouldPanicWith(t, "'p' exponent requires hexadecimal mantissa", func() { lexOne("1p-2") })
+	shouldPanicWith(t, "'e' exponent requires decimal mantissa", func() { lexOne("0o1e5") })
+	shouldPanicWith(t, "exponent has no digits", func() { lexOne("1e+") })
+	shouldPanicWith(t, "exponent has no digits", func() { lexOne("0x1p") })
+	shouldPanicWith(t, "<test>:1:3 - '_' must separate successive digits", func() { lexOne("1__2") })
+	shouldPanicWith(t, "'_' must separate successive digits", func() { lexOne("12_") })
+	shouldPanicWith(t, "'_' must separate successive digits", func() { lexOne("0_x12") })
+	shouldPanicWith(t, "'_' must separate successive digits", func() { lexOne("1_.5") })
+	shouldPanicWith(t, "'_' must separate successive digits", func() { lexOne("0x__1") })
+}
+
+func TestStringLiterals(t *t.T) {
+	assert(t, lexOne(`"hello"`).Payload.(string) == "hello")
+	assert(t, lexOne(`"\u65e5本\U00008a9e"`).Payload.(string) == "日本語")
+	assert(t, lexOne(`"\xff\000\n"`).Payload.(string) == "\xff\x00\n")
+	assert(t, lexOne("`a\\b\r\nc`").Payload.(string) == "a\\b\nc")
+	assert(t, lexOne(`'\''`).Payload.(rune) == '\'')
+	assert(t, lexOne(`'\xff'`).Payload.(rune) == 0xff)
+	assert(t, lexOne(`'本'`).Payload.(rune) == '本')
+
+	shouldPanicWith(t, "string literal not terminated", func() { lexOne(`"abc`) })
+	shouldPanicWith(t, "string literal not terminated", func() { lexOne("\"abc\n\"") })
+	shouldPanicWith(t, "raw string literal not terminated", func() { lexOne("`abc") })
+	shouldPanicWith(t, "comment not terminated", func() { lexOne("/* abc") })
+	shouldPanicWith(t, "illegal character NUL", func() { lexOne("a\x00") })
+	shouldPanicWith(t, "<test>:1:3 - illegal character U+0024 '$'", func() {
+		l := makeTestLexer("x $")
+		l.NextToken()
+		l.NextToken()
+	})
+	shouldPanicWith(t, "invalid UTF-8 encoding", func() { lexOne("\xff") })
+}
+
+func TestTokenSpans(t *t.T) {
+	src := "x := \"日本\" // c\n"
+	l := makeTestLexer(src)
+	f := l.File()
+	for tok := l.NextToken(); tok.Type != EndOfFile; tok = l.NextToken() {
+		assert(t, src[f.Offset(tok.Pos):f.Offset(tok.End)] == tok.SourceCode)
+	}
+}
+
+// A representative chunk of Go source, repeated to make large inputs.
+const benchmarkChunk = `// Package chunk is used for benchmarking.
+package chunk
+
+import "fmt"
+
+/* A block comment
+   spanning lines */
+type Point struct {
+	X, Y float64 ` + "`json:\"x\"`" + `
+}
+
+func (p *Point) Scale(k float64) string {
+	p.X *= k * 0x1p-2
+	p.Y *= k / 1_000.5e3
+	return fmt.Sprintf("%v\t%v\n", p.X, p.Y) + "日本語"
+}
+`
+
+func benchmarkLexer(b *t.B, src []byte) {
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := MakeLexer(NewFileSet().AddFile("bench.go", len(src)), src)
+		for l.NextToken().Type != EndOfFile {
+		}
+	}
+}
+
+// Throughput (MB/s) should stay flat as the input grows.
+func BenchmarkLexer(b *t.B) {
+	for _, mb := range []int{1, 4, 16} {
+		src := []byte(strings.Repeat(benchmarkChunk, mb<<20/len(benchmarkChunk)))
+		b.Run(fmt.Sprintf("%dMB", mb), func(b *t.B) { benchmarkLexer(b, src) })
+	}
+}
+
+// A single huge token used to be quadratic.
+func BenchmarkLexerLongString(b *t.B) {
+	for _, mb := range []int{1, 4, 16} {
+		src := []byte("\"" + strings.Repeat("abcdefgh", mb<<20/8) + "\"")
+		b.Run(fmt.Sprintf("%dMB", mb), func(b *t.B) { benchmarkLexer(b, src) })
+	}
+}
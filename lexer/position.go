@@ -0,0 +1,205 @@
+package lexer
+
+import "fmt"
+import "sort"
+import "sync"
+
+////////////////////////////////////////////////////////////////////////////////
+// Positions
+//   A Pos is a compact position: an offset into the address space of a FileSet,
+//   in which each File occupies the range [base, base+size]. A Position is the
+//   human-readable form of a Pos, and is obtained through the FileSet or File.
+
+type Pos int
+
+const NoPos Pos = 0
+
+func (p Pos) IsValid() bool { return p != NoPos }
+
+type Position struct {
+	Filename string
+	Offset   int // Byte offset from the start of the file, starting at 0
+	Line     int // Starting at 1
+	Column   int // Byte offset from the start of the line, starting at 1
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// file:line:column, file:line, or file if the line and column are unknown
+func (p Position) String() string {
+	s := p.Filename
+	if s == "" {
+		s = "-"
+	}
+	if p.IsValid() {
+		s += fmt.Sprintf(":%d", p.Line)
+		if p.Column != 0 {
+			s += fmt.Sprintf(":%d", p.Column)
+		}
+	}
+	return s
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// FileSet
+
+type FileSet struct {
+	mutex sync.RWMutex
+	base  int     // Base of the next file to be added
+	files []*File // Sorted by base
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{base: 1} // 0 is NoPos
+}
+
+// Adds a file of the given size. The returned File's line table is filled in
+// by the Lexer as it scans the file.
+func (s *FileSet) AddFile(filename string, size int) *File {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f := &File{name: filename, base: s.base, size: size, lines: []int{0}}
+	s.base += size + 1 // +1 so that the end of file position is unique
+	s.files = append(s.files, f)
+	return f
+}
+
+// The file containing p, or nil if there isn't one.
+func (s *FileSet) File(p Pos) *File {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > int(p) }) - 1
+	if i >= 0 && int(p) <= s.files[i].base+s.files[i].size {
+		return s.files[i]
+	}
+	return nil
+}
+
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.Position(p)
+	}
+	return Position{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// File
+
+type File struct {
+	name string
+	base int
+	size int
+
+	mutex sync.Mutex
+	lines []int      // Offset of the first character of each line
+	infos []lineInfo // From //line directives, sorted by offset
+}
+
+// From a //line directive: the character at Offset is at Filename:Line:Column.
+type lineInfo struct {
+	Offset   int
+	Filename string
+	Line     int
+	Column   int // 0 if unknown
+}
+
+func (f *File) Name() string { return f.name }
+func (f *File) Base() int    { return f.base }
+func (f *File) Size() int    { return f.size }
+
+func (f *File) LineCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.lines)
+}
+
+// Records that a new line starts at offset. Lines must be added in order.
+func (f *File) AddLine(offset int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if offset > f.lines[len(f.lines)-1] && offset <= f.size {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+// Records that the character at offset is at filename:line:column for the
+// purposes of Position. Column 0 means the column is unknown.
+func (f *File) AddLineColumnInfo(offset int, filename string, line, column int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if i := len(f.infos); i == 0 || f.infos[i-1].Offset < offset {
+		f.infos = append(f.infos, lineInfo{offset, filename, line, column})
+	}
+}
+
+func (f *File) Pos(offset int) Pos {
+	if offset < 0 || offset > f.size {
+		panic(fmt.Sprintf("ICE: offset %d out of range for %s", offset, f.name))
+	}
+	return Pos(f.base + offset)
+}
+
+func (f *File) Offset(p Pos) int {
+	if int(p) < f.base || int(p) > f.base+f.size {
+		panic(fmt.Sprintf("ICE: Pos %d out of range for %s", p, f.name))
+	}
+	return int(p) - f.base
+}
+
+// The line number of p, ignoring //line directives.
+func (f *File) Line(p Pos) int {
+	return f.PositionFor(p, false).Line
+}
+
+// The start of the given line, ignoring //line directives.
+func (f *File) LineStart(line int) Pos {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if line < 1 || line > len(f.lines) {
+		panic(fmt.Sprintf("ICE: line %d out of range for %s", line, f.name))
+	}
+	return Pos(f.base + f.lines[line-1])
+}
+
+// The position of p, adjusted by any //line directives.
+func (f *File) Position(p Pos) Position {
+	return f.PositionFor(p, true)
+}
+
+func (f *File) PositionFor(p Pos, adjusted bool) Position {
+	if !p.IsValid() {
+		return Position{}
+	}
+	offset := f.Offset(p)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	line, column := f.unpack(offset)
+	pos := Position{Filename: f.name, Offset: offset, Line: line, Column: column}
+
+	if adjusted {
+		i := sort.Search(len(f.infos), func(i int) bool { return f.infos[i].Offset > offset }) - 1
+		if i >= 0 {
+			alt := f.infos[i]
+			altLine, _ := f.unpack(alt.Offset)
+			pos.Filename = alt.Filename
+			pos.Line = alt.Line + (line - altLine)
+			if alt.Column == 0 {
+				pos.Column = 0
+			} else if line == altLine {
+				pos.Column = alt.Column + (offset - alt.Offset)
+			}
+		}
+	}
+
+	return pos
+}
+
+// Line and column of offset. The caller must hold f.mutex.
+func (f *File) unpack(offset int) (line, column int) {
+	i := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return i + 1, offset - f.lines[i] + 1
+}
@@ -0,0 +1,66 @@
+package lexer
+
+import t "testing"
+
+// Lexes all of src, so that the line table and //line directives are filled in.
+func lexAll(fset *FileSet, name, src string) *File {
+	l := MakeLexer(fset.AddFile(name, len(src)), []byte(src))
+	for l.NextToken().Type != EndOfFile {
+	}
+	return l.File()
+}
+
+func TestFileSet(t *t.T) {
+	fset := NewFileSet()
+	a := lexAll(fset, "a.go", "package a\n")
+	b := lexAll(fset, "b.go", "package b\n\nvar x int\n")
+
+	assert(t, a.Base() == 1 && b.Base() == a.Base()+a.Size()+1)
+	assert(t, fset.File(a.Pos(0)) == a && fset.File(a.Pos(a.Size())) == a)
+	assert(t, fset.File(b.Pos(0)) == b && fset.File(b.Pos(b.Size())) == b)
+	assert(t, fset.File(NoPos) == nil && fset.File(b.Pos(b.Size())+1) == nil)
+
+	assert(t, fset.Position(b.Pos(15)) == Position{Filename: "b.go", Offset: 15, Line: 3, Column: 5})
+	assert(t, fset.Position(b.Pos(15)).String() == "b.go:3:5")
+	assert(t, fset.Position(NoPos).String() == "-")
+	assert(t, b.LineCount() == 4 && b.LineStart(3) == b.Pos(11))
+	assert(t, b.Line(b.Pos(10)) == 2)
+}
+
+func TestColumnsAreBytes(t *t.T) {
+	f := lexAll(NewFileSet(), "<test>", "x := \"日本\" + y")
+	assert(t, f.Position(f.Pos(14)).Column == 15)
+}
+
+func TestLineDirectives(t *t.T) {
+	src := "package p\n" +
+		"//line gen.y:100\n" +
+		"var a int\n" +
+		"//line :200:5\n" +
+		"var b int\n" +
+		"var c /*line other.y:7:3*/int\n" +
+		"  //line not.y:1\n" +
+		"var d int\n"
+	f := lexAll(NewFileSet(), "p.go", src)
+	pos := func(substr string) Position {
+		for i := 0; i+len(substr) <= len(src); i++ {
+			if src[i:i+len(substr)] == substr {
+				return f.Position(f.Pos(i))
+			}
+		}
+		panic("not found")
+	}
+
+	assert(t, pos("package").String() == "p.go:1:1")
+	assert(t, pos("var a").String() == "gen.y:100") // The column is unknown
+	assert(t, pos("a int").String() == "gen.y:100")
+	assert(t, pos("var b").String() == "gen.y:200:5")
+	assert(t, pos("b int").String() == "gen.y:200:9")
+	assert(t, pos("var c").String() == "gen.y:201:1")
+	assert(t, pos("int\n  //").String() == "other.y:7:3")
+	assert(t, pos("var d").String() == "other.y:9:1")
+	assert(t, f.PositionFor(f.Pos(0)+Pos(len(src)-4), false).String() == "p.go:8:7")
+
+	shouldPanicWith(t, "<test>:1:1 - invalid line number", func() { lexAll(NewFileSet(), "<test>", "//line x.go:0\n") })
+	shouldPanicWith(t, "<test>:1:1 - invalid column number", func() { lexAll(NewFileSet(), "<test>", "//line x.go:1:0\n") })
+}
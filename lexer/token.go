@@ -1,22 +1,13 @@
 package lexer
 
 type Token struct {
-	Position   Position
+	Pos        Pos // Position of the first character
+	End        Pos // Position just after the last character
 	Type       TokenType
 	SourceCode string
 	Payload    interface{}
 }
 
-type Position struct {
-	Filename string
-	Line     int
-	Column   int
-}
-
-func (p Position) Move(cols int) Position {
-	return Position{p.Filename, p.Line, p.Column + cols}
-}
-
 type TokenType int
 
 func (tt TokenType) String() string {
@@ -137,6 +128,7 @@ const (
 	ChanOpOp    // <-
 	IncrementOp // ++
 	DecrementOp // --
+	TildeOp     // ~
 
 	EllipsisOp // ...
 
@@ -274,6 +266,7 @@ var tokenToStringMap = map[TokenType]string{
 	ChanOpOp:           "<-",
 	IncrementOp:        "++",
 	DecrementOp:        "--",
+	TildeOp:            "~",
 	EllipsisOp:         "...",
 	EndOfLine:          "\\n",
 	ElidedSemicolon:    "[;]",
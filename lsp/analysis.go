@@ -0,0 +1,406 @@
+package lsp
+
+import "sort"
+import "strings"
+import "unicode"
+import "unicode/utf8"
+import "github.com/MerryMage/agi/lexer"
+import "github.com/MerryMage/agi/parser"
+
+////////////////////////////////////////////////////////////////////////////////
+// Name resolution
+//   Identifiers are resolved by scope within the file. A declaring identifier
+//   resolves to itself. A type name resolves to the innermost type parameter
+//   or top-level declaration of that name, and a package qualifier to its
+//   import. Names qualified by a package aren't resolved.
+
+// The path (innermost first) to the identifier at p in the last parse, or nil.
+func (d *document) identifierAt(p Position) []parser.ASTNode {
+	if d.ast == nil {
+		return nil
+	}
+	// A cursor just after an identifier, as when typing, is also on it
+	pos := d.astOffset(p)
+	for _, pos := range []lexer.Pos{pos, pos - 1} {
+		path := parser.PathTo(*d.ast, pos)
+		if _, ok := path[0].(parser.Identifier); ok {
+			return path
+		}
+	}
+	return nil
+}
+
+// The declaration which the identifier at path[0] refers to: an Identifier or
+// an Import. Returns nil if it can't be resolved.
+func resolve(f *parser.File, path []parser.ASTNode) parser.ASTNode {
+	id := path[0].(parser.Identifier)
+	ref, ok := path[1].(parser.NamedTypeRef)
+	if !ok {
+		return id
+	}
+	if ref.Package != nil {
+		if ref.Package.Begin() != id.Begin() {
+			return nil
+		}
+		for _, i := range f.Imports {
+			if importName(i) == id.Name {
+				return i
+			}
+		}
+		return nil
+	}
+
+	for _, n := range path[2:] {
+		var params []parser.Identifier
+		switch n := n.(type) {
+		case parser.TypeSpec:
+			params = typeParamNames(n.TypeParams)
+		case parser.FuncOrMethodDecl:
+			params = typeParamNames(n.TypeParams)
+			if n.Receiver != nil && len(n.Receiver.Decls) > 0 {
+				params = append(params, receiverTypeParams(n.Receiver.Decls[0].Type)...)
+			}
+		}
+		for _, p := range params {
+			if p.Name == id.Name {
+				return p
+			}
+		}
+	}
+	for _, name := range topLevelNames(f) {
+		if name.Name == id.Name {
+			return name
+		}
+	}
+	return nil
+}
+
+func typeParamNames(tl *parser.TypeParamList) []parser.Identifier {
+	var names []parser.Identifier
+	if tl != nil {
+		for _, p := range tl.Params {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// The type parameters declared by a receiver: T in (l *List[T]).
+func receiverTypeParams(t parser.TypeRef) []parser.Identifier {
+	if ptr, ok := t.(parser.PointerTypeRef); ok {
+		t = ptr.BaseType
+	}
+	var names []parser.Identifier
+	if ref, ok := t.(parser.NamedTypeRef); ok {
+		for _, arg := range ref.TypeArgs {
+			if arg, ok := arg.(parser.NamedTypeRef); ok && arg.Package == nil {
+				names = append(names, arg.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Types, functions and variables declared at the top level. Methods aren't
+// in the file's scope.
+func topLevelNames(f *parser.File) []parser.Identifier {
+	var names []parser.Identifier
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case parser.FuncOrMethodDecl:
+			if decl.Receiver == nil {
+				names = append(names, decl.FunctionName)
+			}
+		case parser.TypeDecl:
+			for _, s := range decl.Specs {
+				names = append(names, s.Name)
+			}
+		case parser.VarDecl:
+			for _, s := range decl.Specs {
+				names = append(names, s.Names...)
+			}
+		}
+	}
+	return names
+}
+
+// The name an import is referred to by: its nickname, or the last element of
+// its path. (The package clause of the imported package isn't known.)
+func importName(i parser.Import) string {
+	if i.PackageNickname != "" {
+		return i.PackageNickname
+	}
+	return i.ImportPath[strings.LastIndex(i.ImportPath, "/")+1:]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Requests
+
+func (d *document) definition(p Position) *Location {
+	path := d.identifierAt(p)
+	if path == nil {
+		return nil
+	}
+	if target := resolve(d.ast, path); target != nil {
+		return &Location{d.uri, d.astRange(target)}
+	}
+	return nil
+}
+
+func (d *document) references(p Position, includeDeclaration bool) []Location {
+	refs := []Location{}
+	path := d.identifierAt(p)
+	if path == nil {
+		return refs
+	}
+	target := resolve(d.ast, path)
+	if target == nil {
+		return refs
+	}
+
+	var stack []parser.ASTNode
+	parser.Inspect(*d.ast, func(n parser.ASTNode) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		stack = append(stack, n)
+		if _, ok := n.(parser.Identifier); !ok {
+			return true
+		}
+
+		path := make([]parser.ASTNode, len(stack))
+		for i, n := range stack {
+			path[len(stack)-1-i] = n
+		}
+		if t := resolve(d.ast, path); t != nil && t.Begin() == target.Begin() {
+			if includeDeclaration || n.Begin() != target.Begin() {
+				refs = append(refs, Location{d.uri, d.astRange(n)})
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+func (d *document) hover(p Position) *Hover {
+	path := d.identifierAt(p)
+	if path == nil {
+		return nil
+	}
+	target := resolve(d.ast, path)
+	if target == nil {
+		return nil
+	}
+
+	var text string
+	var doc *parser.CommentGroup
+	if i, ok := target.(parser.Import); ok {
+		text = "import " + d.astText(i.Begin(), i.End())
+	} else {
+		decl := parser.PathTo(*d.ast, target.Begin())
+		switch n := decl[1].(type) {
+		case parser.TypeSpec:
+			text = "type " + d.astText(n.Begin(), n.End())
+			doc = n.Doc
+			if td, ok := decl[2].(parser.TypeDecl); ok && doc == nil && len(td.Specs) == 1 {
+				doc = td.Doc
+			}
+		case parser.VarSpec:
+			text = "var " + d.astText(n.Begin(), n.End())
+			doc = n.Doc
+			if vd, ok := decl[2].(parser.VarDecl); ok && doc == nil && len(vd.Specs) == 1 {
+				doc = vd.Doc
+			}
+		case parser.FuncOrMethodDecl:
+			text = d.astText(n.Begin(), n.Signature.End())
+			doc = n.Doc
+		case parser.InterfaceMethodSpec:
+			text = "func " + d.astText(n.Begin(), n.End())
+			doc = n.Doc
+		case parser.StructTypeRefField:
+			text = "field " + d.astText(n.Begin(), n.Type.End())
+			doc = n.Doc
+		case parser.ParameterDecl:
+			text = "var " + d.astText(n.Begin(), n.End())
+		case parser.TypeParam:
+			text = "type parameter " + d.astText(n.Begin(), n.End())
+		case parser.NamedTypeRef:
+			text = "type parameter " + target.(parser.Identifier).Name
+		default:
+			return nil
+		}
+	}
+
+	value := "```go\n" + text + "\n```"
+	if doc != nil {
+		value += "\n\n" + doc.Text()
+	}
+	return &Hover{MarkupContent{"markdown", value}, d.astRange(path[0])}
+}
+
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	if d.ast == nil {
+		return symbols
+	}
+	for _, decl := range d.ast.Decls {
+		switch decl := decl.(type) {
+		case parser.FuncOrMethodDecl:
+			s := DocumentSymbol{
+				Name:           decl.FunctionName.Name,
+				Detail:         "func" + d.astText(decl.Signature.Begin(), decl.Signature.End()),
+				Kind:           symbolFunction,
+				Range:          d.astRange(decl),
+				SelectionRange: d.astRange(decl.FunctionName),
+			}
+			if decl.Receiver != nil && len(decl.Receiver.Decls) > 0 {
+				recv := decl.Receiver.Decls[0].Type
+				s.Name = "(" + d.astText(recv.Begin(), recv.End()) + ")." + s.Name
+				s.Kind = symbolMethod
+			}
+			symbols = append(symbols, s)
+		case parser.TypeDecl:
+			for _, spec := range decl.Specs {
+				s := d.typeSymbol(spec)
+				if len(decl.Specs) == 1 {
+					s.Range = d.astRange(decl)
+				}
+				symbols = append(symbols, s)
+			}
+		case parser.VarDecl:
+			for _, spec := range decl.Specs {
+				detail := ""
+				if spec.Type != nil {
+					detail = d.astText(spec.Type.Begin(), spec.Type.End())
+				}
+				for _, name := range spec.Names {
+					symbols = append(symbols, DocumentSymbol{
+						Name:           name.Name,
+						Detail:         detail,
+						Kind:           symbolVariable,
+						Range:          d.astRange(spec),
+						SelectionRange: d.astRange(name),
+					})
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+func (d *document) typeSymbol(spec parser.TypeSpec) DocumentSymbol {
+	s := DocumentSymbol{
+		Name:           spec.Name.Name,
+		Detail:         d.astText(spec.Type.Begin(), spec.Type.End()),
+		Kind:           symbolClass,
+		Range:          d.astRange(spec),
+		SelectionRange: d.astRange(spec.Name),
+	}
+	switch t := spec.Type.(type) {
+	case parser.StructTypeRef:
+		s.Detail = "struct{...}"
+		s.Kind = symbolStruct
+		for _, f := range t.Fields {
+			typ := d.astText(f.Type.Begin(), f.Type.End())
+			if f.Names == nil {
+				// An embedded field is named after its type
+				s.Children = append(s.Children, DocumentSymbol{typ, "", symbolField, d.astRange(f), d.astRange(f.Type), nil})
+				continue
+			}
+			for _, name := range *f.Names {
+				s.Children = append(s.Children, DocumentSymbol{name.Name, typ, symbolField, d.astRange(f), d.astRange(name), nil})
+			}
+		}
+	case parser.InterfaceTypeRef:
+		s.Detail = "interface{...}"
+		s.Kind = symbolInterface
+		for _, f := range t.Fields {
+			if m, ok := f.(parser.InterfaceMethodSpec); ok {
+				sig := "func" + d.astText(m.Signature.Begin(), m.Signature.End())
+				s.Children = append(s.Children, DocumentSymbol{m.MethodName.Name, sig, symbolMethod, d.astRange(m), d.astRange(m.MethodName), nil})
+			}
+		}
+	}
+	return s
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Completion
+//   Offers the names in scope which begin with the word before the cursor.
+//   Selectors (x.y) need the type checker, so nothing is offered for them.
+
+var predeclaredTypes = []string{
+	"any", "bool", "byte", "comparable", "complex64", "complex128", "error",
+	"float32", "float64", "int", "int8", "int16", "int32", "int64", "rune",
+	"string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+}
+
+func (d *document) completion(p Position) CompletionList {
+	list := CompletionList{Items: []CompletionItem{}}
+
+	offset := offsetOf(d.text, d.lines, p)
+	start := offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(d.text[:start])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		start -= size
+	}
+	prefix := d.text[start:offset]
+	if (start > 0 && d.text[start-1] == '.') || d.ast == nil {
+		return list
+	}
+
+	seen := make(map[string]bool)
+	add := func(label string, kind CompletionItemKind, detail string) {
+		if !seen[label] && strings.HasPrefix(label, prefix) {
+			seen[label] = true
+			list.Items = append(list.Items, CompletionItem{label, kind, detail})
+		}
+	}
+
+	// Type parameters are only known if the position is in the last parse
+	if d.src == d.text {
+		for _, n := range parser.PathTo(*d.ast, d.file.Pos(offset)) {
+			switch n := n.(type) {
+			case parser.TypeSpec:
+				for _, name := range typeParamNames(n.TypeParams) {
+					add(name.Name, completionTypeParameter, "")
+				}
+			case parser.FuncOrMethodDecl:
+				for _, name := range typeParamNames(n.TypeParams) {
+					add(name.Name, completionTypeParameter, "")
+				}
+			}
+		}
+	}
+	for _, decl := range d.symbols() {
+		kind := CompletionItemKind(completionClass)
+		switch decl.Kind {
+		case symbolFunction:
+			kind = completionFunction
+		case symbolVariable:
+			kind = completionVariable
+		case symbolStruct:
+			kind = completionStruct
+		case symbolInterface:
+			kind = completionInterface
+		case symbolMethod:
+			continue
+		}
+		add(decl.Name, kind, decl.Detail)
+	}
+	for _, i := range d.ast.Imports {
+		if name := importName(i); name != "_" && name != "." {
+			add(name, completionModule, i.ImportPath)
+		}
+	}
+	for _, name := range predeclaredTypes {
+		add(name, completionClass, "")
+	}
+
+	sort.SliceStable(list.Items, func(i, j int) bool { return list.Items[i].Label < list.Items[j].Label })
+	return list
+}
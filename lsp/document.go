@@ -0,0 +1,158 @@
+package lsp
+
+import "fmt"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+import "github.com/MerryMage/agi/lexer"
+import "github.com/MerryMage/agi/parser"
+
+////////////////////////////////////////////////////////////////////////////////
+// Documents
+//   The text of each open file, and the result of parsing it.
+//
+//   Edits are applied to the text incrementally, but the whole file is
+//   re-parsed after every change: the parser has no way to resume from the
+//   middle of a file, and files are small enough for this not to matter yet.
+
+type document struct {
+	uri      string
+	filename string
+	text     string
+	lines    []int // Offset of the start of each line
+
+	// The last successful parse, which is kept while there are errors so
+	// that navigation keeps working during editing.
+	file     *lexer.File
+	ast      *parser.File
+	src      string // The text ast was parsed from
+	srcLines []int
+
+	diagnostics []Diagnostic
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, filename: strings.TrimPrefix(uri, "file://")}
+	d.setText(text)
+	return d
+}
+
+func (d *document) setText(text string) {
+	d.text = text
+	d.lines = lineStarts(text)
+	d.parse()
+}
+
+func lineStarts(text string) []int {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func (d *document) applyChange(c TextDocumentContentChangeEvent) {
+	if c.Range == nil {
+		d.setText(c.Text)
+		return
+	}
+	start, end := offsetOf(d.text, d.lines, c.Range.Start), offsetOf(d.text, d.lines, c.Range.End)
+	if end < start {
+		start, end = end, start
+	}
+	d.setText(d.text[:start] + c.Text + d.text[end:])
+}
+
+func (d *document) parse() {
+	d.diagnostics = []Diagnostic{}
+	src := d.text
+	file := lexer.NewFileSet().AddFile(d.filename, len(src))
+
+	defer func() {
+		if r := recover(); r != nil {
+			d.diagnostics = append(d.diagnostics, d.errorDiagnostic(fmt.Sprint(r)))
+		}
+	}()
+	l := lexer.MakeLexer(file, []byte(src))
+	p := parser.MakeParser(&l)
+	f := p.ParseFile()
+	d.file, d.ast, d.src, d.srcLines = file, &f, src, d.lines
+}
+
+// Errors are panics of the form "file:line:col - message". Some don't have a
+// position yet; those are reported at the start of the file.
+func (d *document) errorDiagnostic(msg string) Diagnostic {
+	pos := Position{}
+	if rest, ok := strings.CutPrefix(msg, d.filename+":"); ok {
+		if at, text, ok := strings.Cut(rest, " - "); ok {
+			if line, col, ok := strings.Cut(at, ":"); ok {
+				l, err1 := strconv.Atoi(line)
+				c, err2 := strconv.Atoi(col)
+				if err1 == nil && err2 == nil && l >= 1 && l <= len(d.lines) && c >= 1 {
+					pos = positionOf(d.text, d.lines, d.lines[l-1]+c-1)
+					msg = text
+				}
+			}
+		}
+	}
+	return Diagnostic{Range{pos, pos}, severityError, "agi", msg}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Positions
+//   LSP positions are a line and a UTF-16 offset within it; ours are byte
+//   offsets.
+
+func offsetOf(text string, lines []int, p Position) int {
+	if p.Line >= len(lines) {
+		return len(text)
+	}
+	offset := lines[p.Line]
+	for units := 0; units < p.Character && offset < len(text) && text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += utf16Len(r)
+		offset += size
+	}
+	return offset
+}
+
+func positionOf(text string, lines []int, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	line := 0
+	for line+1 < len(lines) && lines[line+1] <= offset {
+		line++
+	}
+	units := 0
+	for _, r := range text[lines[line]:offset] {
+		units += utf16Len(r)
+	}
+	return Position{line, units}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// Positions in the last successful parse, which may be out of date.
+
+func (d *document) astOffset(p Position) lexer.Pos {
+	return d.file.Pos(offsetOf(d.src, d.srcLines, p))
+}
+
+func (d *document) astRange(n parser.ASTNode) Range {
+	return Range{
+		positionOf(d.src, d.srcLines, d.file.Offset(n.Begin())),
+		positionOf(d.src, d.srcLines, d.file.Offset(n.End())),
+	}
+}
+
+func (d *document) astText(begin, end lexer.Pos) string {
+	return d.src[d.file.Offset(begin):d.file.Offset(end)]
+}
@@ -0,0 +1,228 @@
+package lsp
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "strings"
+import t "testing"
+
+func assert(t *t.T, b bool) {
+	if !b {
+		t.FailNow()
+	}
+}
+
+// A scripted client. send returns the id of a request, or 0 for a
+// notification. run serves the whole script and returns every reply in order.
+type script struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (s *script) send(method string, params interface{}) int {
+	m := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	id := 0
+	if !strings.HasPrefix(method, "textDocument/did") && method != "initialized" && method != "exit" {
+		s.nextID++
+		id = s.nextID
+		m["id"] = id
+	}
+	body, _ := json.Marshal(m)
+	fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return id
+}
+
+type reply struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func (s *script) run(t *t.T) []reply {
+	var out bytes.Buffer
+	assert(t, Serve(&s.in, &out) == nil)
+
+	// The output must be nothing but well-formed frames
+	var replies []reply
+	rest := out.String()
+	for rest != "" {
+		var n int
+		_, err := fmt.Sscanf(rest, "Content-Length: %d\r\n\r\n", &n)
+		if err != nil {
+			t.Fatalf("bad frame: %q", rest)
+		}
+		rest = rest[strings.Index(rest, "\r\n\r\n")+4:]
+		var rep reply
+		assert(t, n <= len(rest) && json.Unmarshal([]byte(rest[:n]), &rep) == nil)
+		replies = append(replies, rep)
+		rest = rest[n:]
+	}
+	return replies
+}
+
+func result(t *t.T, replies []reply, id int, v interface{}) {
+	for _, r := range replies {
+		if r.ID != nil && *r.ID == id {
+			assert(t, r.Error == nil)
+			assert(t, json.Unmarshal(r.Result, v) == nil)
+			return
+		}
+	}
+	t.Fatalf("no reply to request %d", id)
+}
+
+func diagnostics(t *t.T, replies []reply) [][]Diagnostic {
+	var all [][]Diagnostic
+	for _, r := range replies {
+		if r.Method == "textDocument/publishDiagnostics" {
+			var p PublishDiagnosticsParams
+			assert(t, json.Unmarshal(r.Params, &p) == nil)
+			all = append(all, p.Diagnostics)
+		}
+	}
+	return all
+}
+
+const uri = "file:///src/p.go"
+
+const testSrc = `package p
+
+import "strings"
+
+// List is a list.
+type List[T any] struct {
+	next *List[T]
+	val  T
+	b    strings.Builder
+}
+
+func (l *List[T]) Push(v T) *List[T]
+
+var héllo, x List[int]
+`
+
+func at(line, char int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{line, char}}
+}
+
+func TestSession(t *t.T) {
+	var s script
+	initID := s.send("initialize", map[string]interface{}{})
+	s.send("initialized", map[string]interface{}{})
+	s.send("textDocument/didOpen", DidOpenTextDocumentParams{TextDocumentItem{uri, "go", 1, "package p\n\nfunc (x T) () {}\n"}})
+	s.send("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []TextDocumentContentChangeEvent{{Text: testSrc}},
+	})
+	symbolsID := s.send("textDocument/documentSymbol", DocumentSymbolParams{TextDocumentIdentifier{uri}})
+	defID := s.send("textDocument/definition", at(13, 14))    // List in "var héllo, x List[int]"
+	tparamID := s.send("textDocument/definition", at(11, 25)) // T in "Push(v T)"
+	afterID := s.send("textDocument/definition", at(13, 17))  // Just after List
+	refsID := s.send("textDocument/references", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{uri},
+		"position":     Position{5, 5}, // List in its declaration
+		"context":      map[string]bool{"includeDeclaration": true},
+	})
+	hoverID := s.send("textDocument/hover", at(13, 14))
+	importID := s.send("textDocument/hover", at(8, 8)) // strings in strings.Builder
+	complID := s.send("textDocument/completion", at(13, 14))
+	unknownID := s.send("workspace/symbol", map[string]string{"query": "List"})
+	s.send("shutdown", nil)
+	lateID := s.send("textDocument/hover", at(13, 14))
+	s.send("exit", nil)
+	replies := s.run(t)
+
+	var init map[string]interface{}
+	result(t, replies, initID, &init)
+	assert(t, init["capabilities"] != nil)
+
+	// The first version has a syntax error, which the change fixes
+	diags := diagnostics(t, replies)
+	assert(t, len(diags) == 2)
+	assert(t, len(diags[0]) == 1 && diags[0][0].Message == "a function name was expected here")
+	assert(t, diags[0][0].Range.Start == Position{2, 11})
+	assert(t, len(diags[1]) == 0)
+
+	var symbols []DocumentSymbol
+	result(t, replies, symbolsID, &symbols)
+	var names []string
+	for _, s := range symbols {
+		names = append(names, s.Name)
+	}
+	assert(t, strings.Join(names, " ") == "List (*List[T]).Push héllo x")
+	assert(t, symbols[0].Kind == symbolStruct && len(symbols[0].Children) == 3 && symbols[0].Children[1].Name == "val")
+	assert(t, symbols[0].Range.Start == Position{5, 0})
+	// Characters are counted in UTF-16 code units
+	assert(t, symbols[3].SelectionRange == Range{Position{13, 11}, Position{13, 12}})
+
+	var def Location
+	result(t, replies, defID, &def)
+	assert(t, def.URI == uri && def.Range == Range{Position{5, 5}, Position{5, 9}})
+	result(t, replies, tparamID, &def)
+	assert(t, def.Range == Range{Position{11, 14}, Position{11, 15}}) // The receiver's T
+	result(t, replies, afterID, &def)
+	assert(t, def.Range == Range{Position{5, 5}, Position{5, 9}})
+
+	var refs []Location
+	result(t, replies, refsID, &refs)
+	assert(t, len(refs) == 5) // The declaration, next, the receiver, the result, and the var
+
+	var hover Hover
+	result(t, replies, hoverID, &hover)
+	assert(t, strings.HasPrefix(hover.Contents.Value, "```go\ntype List[T any] struct {"))
+	assert(t, strings.HasSuffix(hover.Contents.Value, "\n\nList is a list.\n"))
+	result(t, replies, importID, &hover)
+	assert(t, hover.Contents.Value == "```go\nimport \"strings\"\n```")
+
+	var compl CompletionList
+	result(t, replies, complID, &compl)
+	var labels []string
+	for _, i := range compl.Items {
+		labels = append(labels, i.Label)
+	}
+	assert(t, strings.Join(labels, " ") == "List")
+
+	for _, r := range replies {
+		if r.ID != nil && *r.ID == unknownID {
+			assert(t, r.Error != nil && r.Error.Code == methodNotFound)
+		}
+		if r.ID != nil && *r.ID == lateID {
+			assert(t, r.Error != nil && r.Error.Code == invalidRequest)
+		}
+	}
+}
+
+func TestIncrementalChanges(t *t.T) {
+	d := newDocument(uri, "package p\n\ntype A int\n")
+	d.applyChange(TextDocumentContentChangeEvent{&Range{Position{2, 5}, Position{2, 6}}, "Bee"})
+	assert(t, d.text == "package p\n\ntype Bee int\n")
+	assert(t, len(d.diagnostics) == 0 && d.symbols()[0].Name == "Bee")
+
+	// Errors keep the last good parse
+	d.applyChange(TextDocumentContentChangeEvent{&Range{Position{2, 0}, Position{2, 4}}, "func"})
+	assert(t, len(d.diagnostics) == 1 && d.symbols()[0].Name == "Bee")
+
+	// Selectors aren't completed
+	d.applyChange(TextDocumentContentChangeEvent{nil, "package p\n\nimport \"fmt\"\n\nvar x fmt.\n"})
+	assert(t, len(d.completion(Position{4, 10}).Items) == 0)
+}
+
+func TestIllegalCharacter(t *t.T) {
+	var s script
+	s.send("initialize", map[string]interface{}{})
+	s.send("textDocument/didOpen", DidOpenTextDocumentParams{TextDocumentItem{uri, "go", 1, "package p\n\nvar x $ int\n"}})
+	symbolsID := s.send("textDocument/documentSymbol", DocumentSymbolParams{TextDocumentIdentifier{uri}})
+	s.send("exit", nil)
+	replies := s.run(t)
+
+	diags := diagnostics(t, replies)
+	assert(t, len(diags) == 1 && len(diags[0]) == 1)
+	assert(t, diags[0][0].Message == "illegal character U+0024 '$'")
+	assert(t, diags[0][0].Range.Start == Position{2, 6})
+
+	var symbols []DocumentSymbol
+	result(t, replies, symbolsID, &symbols)
+	assert(t, len(symbols) == 0)
+}
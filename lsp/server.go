@@ -0,0 +1,178 @@
+package lsp
+
+import "bufio"
+import "encoding/json"
+import "io"
+
+////////////////////////////////////////////////////////////////////////////////
+// Server
+//   A language server for a single client, over a pair of streams.
+//
+//   Everything is answered from one file at a time: there is no type checker
+//   or package loader yet, so there are no types to show on hover, and
+//   names from other files or packages can't be resolved or completed.
+
+type server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+// Serves requests from r until the client sends "exit" or closes r.
+func Serve(r io.Reader, w io.Writer) error {
+	s := server{in: bufio.NewReader(r), out: w, docs: make(map[string]*document)}
+	for {
+		m, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if m.Error != nil {
+			// The message wasn't valid JSON, so we don't know its id
+			null := json.RawMessage("null")
+			if err := writeMessage(s.out, &message{ID: &null, Error: m.Error}); err != nil {
+				return err
+			}
+			continue
+		}
+		if m.Method == "exit" {
+			return nil
+		}
+		if m.ID == nil {
+			if err := s.notification(m.Method, m.Params); err != nil {
+				return err
+			}
+			continue
+		}
+
+		response := &message{ID: m.ID}
+		result, rerr := s.request(m.Method, m.Params)
+		if rerr != nil {
+			response.Error = rerr
+		} else if response.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+		if err := writeMessage(s.out, response); err != nil {
+			return err
+		}
+	}
+}
+
+func decodeParams(params json.RawMessage, v interface{}) *responseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{invalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *server) request(method string, params json.RawMessage) (interface{}, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{invalidRequest, "the server has been shut down"}
+	}
+
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    2, // Incremental
+				},
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]interface{}{"name": "agi"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	}
+
+	// Unknown methods are reported as such whatever their parameters
+	switch method {
+	case "textDocument/documentSymbol", "textDocument/hover", "textDocument/definition",
+		"textDocument/references", "textDocument/completion":
+	default:
+		return nil, &responseError{methodNotFound, "method not supported: " + method}
+	}
+
+	var p ReferenceParams // Covers every request on a position or a document
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil {
+		return nil, &responseError{invalidParams, "unknown document " + p.TextDocument.URI}
+	}
+
+	switch method {
+	case "textDocument/documentSymbol":
+		return d.symbols(), nil
+	case "textDocument/hover":
+		if h := d.hover(p.Position); h != nil {
+			return h, nil
+		}
+		return nil, nil
+	case "textDocument/definition":
+		if loc := d.definition(p.Position); loc != nil {
+			return loc, nil
+		}
+		return nil, nil
+	case "textDocument/references":
+		return d.references(p.Position, p.Context.IncludeDeclaration), nil
+	case "textDocument/completion":
+		return d.completion(p.Position), nil
+	}
+	return nil, &responseError{methodNotFound, "method not supported: " + method}
+}
+
+// Unknown notifications, and those with invalid parameters, are ignored.
+func (s *server) notification(method string, params json.RawMessage) error {
+	switch method {
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if decodeParams(params, &p) != nil {
+			return nil
+		}
+		d := newDocument(p.TextDocument.URI, p.TextDocument.Text)
+		s.docs[d.uri] = d
+		return s.publishDiagnostics(d.uri, d.diagnostics)
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if decodeParams(params, &p) != nil {
+			return nil
+		}
+		d := s.docs[p.TextDocument.URI]
+		if d == nil {
+			return nil
+		}
+		for _, c := range p.ContentChanges {
+			d.applyChange(c)
+		}
+		return s.publishDiagnostics(d.uri, d.diagnostics)
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if decodeParams(params, &p) != nil {
+			return nil
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return s.publishDiagnostics(p.TextDocument.URI, []Diagnostic{})
+	}
+	return nil
+}
+
+func (s *server) publishDiagnostics(uri string, diagnostics []Diagnostic) error {
+	params, err := json.Marshal(PublishDiagnosticsParams{uri, diagnostics})
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: "textDocument/publishDiagnostics", Params: params})
+}
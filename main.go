@@ -1,21 +1,34 @@
 package main
 
 import "os"
-import "bufio"
 import "fmt"
-import "github.com/MerryMage/agi/lexer"
+import "github.com/MerryMage/agi/lsp"
 
 func main() {
-	f, err := os.Open("./lexer.go")
-	if err != nil {
-		panic("Couldn't open main.go")
+	if len(os.Args) < 2 {
+		usage()
 	}
-	l := lexer.MakeLexer(bufio.NewReader(f), "main.go")
-	for {
-		t := l.NextToken()
-		fmt.Printf("%v\n", t)
-		if t.Type == lexer.EndOfFile {
-			break
+	switch os.Args[1] {
+	case "fmt":
+		os.Exit(fmtMain(os.Args[2:]))
+	case "tokens":
+		os.Exit(dumpMain("tokens", os.Args[2:], dumpTokens))
+	case "ast":
+		os.Exit(dumpMain("ast", os.Args[2:], dumpAST))
+	case "lsp":
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+	default:
+		usage()
 	}
 }
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: agi fmt [-l] [-d] [-w] [path ...]")
+	fmt.Fprintln(os.Stderr, "       agi tokens [-format json|sexp] [file]")
+	fmt.Fprintln(os.Stderr, "       agi ast [-format json|sexp] [file]")
+	fmt.Fprintln(os.Stderr, "       agi lsp")
+	os.Exit(2)
+}
@@ -0,0 +1,110 @@
+package parser
+
+import "github.com/MerryMage/agi/lexer"
+import "strings"
+
+////////////////////////////////////////////////////////////////////////////////
+// Comments
+//   Every comment in a file is kept in File.Comments, grouped into runs of
+//   adjacent comments. A group ending on the line immediately before a
+//   declaration, struct field or interface method is also attached to that
+//   node as its Doc.
+
+type Comment struct {
+	pos  lexer.Pos
+	Text string // Including the comment markers: "// ..." or "/* ... */"
+}
+
+func (c Comment) Begin() lexer.Pos { return c.pos }
+func (c Comment) End() lexer.Pos   { return c.pos + lexer.Pos(len(c.Text)) }
+func (c Comment) _astNode()        {}
+
+type CommentGroup struct {
+	List []Comment
+}
+
+func (g CommentGroup) Begin() lexer.Pos { return g.List[0].Begin() }
+func (g CommentGroup) End() lexer.Pos   { return g.List[len(g.List)-1].End() }
+func (g CommentGroup) _astNode()        {}
+
+// The text of the comment group with comment markers, trailing whitespace and
+// leading and trailing blank lines removed. Directives such as "//go:noinline"
+// are not included. Lines are terminated with "\n".
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+
+	var lines []string
+	for _, c := range g.List {
+		text := c.Text
+		if strings.HasPrefix(text, "//") {
+			text = text[2:]
+			if isDirective(text) {
+				continue
+			}
+			// Strip the first space, if any: "// text" is conventional
+			text = strings.TrimPrefix(text, " ")
+		} else {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// "//go:noinline" and friends: no space after the //, then name:
+func isDirective(text string) bool {
+	colon := strings.Index(text, ":")
+	if colon <= 0 || colon+1 >= len(text) {
+		return false
+	}
+	for _, ch := range text[:colon] {
+		if !('a' <= ch && ch <= 'z') && !('0' <= ch && ch <= '9') {
+			return false
+		}
+	}
+	ch := text[colon+1]
+	return 'a' <= ch && ch <= 'z'
+}
+
+// Called by nextToken for each comment token between p.t and p.peekt.
+// Returns the group the comment was added to.
+func (p *Parser) recordComment(t lexer.Token, group *CommentGroup, trailing bool) (*CommentGroup, bool) {
+	c := Comment{t.Pos, t.SourceCode}
+
+	// A comment on the same line as the previous token is a trailing comment
+	// for that token. It's kept in its own group so it can't become a Doc.
+	isTrailing := p.t.Type != lexer.EndOfFile && p.line(c.pos) == p.line(p.t.Pos)
+
+	if group == nil || trailing != isTrailing || p.line(c.Begin()) > p.line(group.End())+1 {
+		group = &CommentGroup{}
+		p.comments = append(p.comments, group)
+	}
+	group.List = append(group.List, c)
+	return group, isTrailing
+}
+
+// Is group the doc comment for the token t?
+func (p *Parser) isDocFor(group *CommentGroup, trailing bool, t lexer.Token) bool {
+	if group == nil || trailing {
+		return false
+	}
+	switch t.Type {
+	case lexer.Semicolon, lexer.EndOfFile, lexer.RBrace, lexer.RParen:
+		return false
+	}
+	return p.line(group.End())+1 >= p.line(t.Pos)
+}
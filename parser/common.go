@@ -8,15 +8,25 @@ import "fmt"
 
 func (p *Parser) nextToken() {
 	p.t = p.peekt
+	p.doc = p.peekDoc
+
+	var group *CommentGroup
+	trailing := false
 again:
 	p.peekt = p.l.NextToken()
 	if p.peekt.IsComment() {
+		group, trailing = p.recordComment(p.peekt, group, trailing)
 		goto again
 	} else if p.peekt.Type == lexer.ElidedSemicolon {
 		p.peekt.Type = lexer.Semicolon
 	} else if p.peekt.Type == lexer.EndOfLine {
 		goto again
 	}
+
+	p.peekDoc = nil
+	if p.isDocFor(group, trailing, p.peekt) {
+		p.peekDoc = group
+	}
 }
 
 // Will an expect(tt) succeed?
@@ -57,7 +67,16 @@ func (p *Parser) expect(panicstr string, tts ...lexer.TokenType) {
 			return
 		}
 	}
-	panic(fmt.Sprintf("%s:%d:%d - %s", p.peekt.Position.Filename, p.peekt.Position.Line, p.peekt.Position.Column, panicstr))
+	p.panicAt(p.peekt.Pos, panicstr)
+}
+
+func (p *Parser) panicAt(pos lexer.Pos, panicstr string) {
+	panic(fmt.Sprintf("%s - %s", p.l.File().Position(pos), panicstr))
+}
+
+// The line pos is on, ignoring //line directives.
+func (p *Parser) line(pos lexer.Pos) int {
+	return p.l.File().Line(pos)
 }
 
 func (p *Parser) expectSemicolon(panicstr string) {
@@ -75,17 +94,17 @@ func (p *Parser) expectSemicolon(panicstr string) {
 // Identifier
 
 type Identifier struct {
-	pos  lexer.Position
+	pos  lexer.Pos
 	Name string
 }
 
-func (i Identifier) Begin() lexer.Position { return i.pos }
-func (i Identifier) End() lexer.Position   { return i.pos.Move(len(i.Name)) }
-func (i Identifier) _astNode()             {}
+func (i Identifier) Begin() lexer.Pos { return i.pos }
+func (i Identifier) End() lexer.Pos   { return i.pos + lexer.Pos(len(i.Name)) }
+func (i Identifier) _astNode()        {}
 
 func (p *Parser) parseIdentifier() Identifier {
 	p.expect("ICE", lexer.Identifier)
-	return Identifier{p.t.Position, p.t.Payload.(string)}
+	return Identifier{p.t.Pos, p.t.Payload.(string)}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -97,8 +116,8 @@ type FunctionSignature struct {
 	Return *ParameterDeclList
 }
 
-func (o FunctionSignature) Begin() lexer.Position { return o.Args.Begin() }
-func (o FunctionSignature) End() lexer.Position {
+func (o FunctionSignature) Begin() lexer.Pos { return o.Args.Begin() }
+func (o FunctionSignature) End() lexer.Pos {
 	if o.Return != nil {
 		return o.Return.End()
 	} else {
@@ -124,14 +143,14 @@ func (p *Parser) parseFunctionSignature(mustNotElideParamNames bool) FunctionSig
 }
 
 type ParameterDeclList struct {
-	begin lexer.Position
+	begin lexer.Pos
 	Decls []ParameterDecl
-	end   lexer.Position
+	end   lexer.Pos
 }
 
-func (o ParameterDeclList) Begin() lexer.Position { return o.begin }
-func (o ParameterDeclList) End() lexer.Position   { return o.end }
-func (o ParameterDeclList) _astNode()             {}
+func (o ParameterDeclList) Begin() lexer.Pos { return o.begin }
+func (o ParameterDeclList) End() lexer.Pos   { return o.end }
+func (o ParameterDeclList) _astNode()        {}
 
 type ParameterDecl struct {
 	Name          *Identifier
@@ -139,9 +158,15 @@ type ParameterDecl struct {
 	Type          TypeRef
 }
 
-func (o ParameterDecl) Begin() lexer.Position { return o.Name.Begin() }
-func (o ParameterDecl) End() lexer.Position   { return o.Type.End() }
-func (o ParameterDecl) _astNode()             {}
+func (o ParameterDecl) Begin() lexer.Pos {
+	if o.Name != nil {
+		return o.Name.Begin()
+	} else {
+		return o.Type.Begin()
+	}
+}
+func (o ParameterDecl) End() lexer.Pos { return o.Type.End() }
+func (o ParameterDecl) _astNode()      {}
 
 func (p *Parser) parseParameterDeclList(mustNotElideParamNames bool) ParameterDeclList {
 	hasTwo := false
@@ -149,30 +174,36 @@ func (p *Parser) parseParameterDeclList(mustNotElideParamNames bool) ParameterDe
 	var dl ParameterDeclList
 
 	p.expect("ICE", lexer.LParen)
-	dl.begin = p.t.Position
+	dl.begin = p.t.Pos
 	if !p.peek(lexer.RParen) {
 		for {
 			var d ParameterDecl
 
-			t1, maybeIdent := p.parseTypeRefOrIdent()
-			if maybeIdent && !p.peek(lexer.Comma) {
+			name, t := p.parseTypeRefOrIdent()
+			if name != nil && t != nil {
+				// Identifier TypeRef, where TypeRef begins with <[>
+				hasTwo = true
+				d.Name = name
+				d.Type = t
+			} else if name != nil && !p.peek(lexer.Comma) && !p.peek(lexer.RParen) {
 				hasTwo = true
-				t2 := p.parseTypeRef()
-				d.Type = t2
-				d.Name = extractIdentPtr(t1)
+				d.Name = name
+				d.Type = p.parseTypeRef()
+			} else if name != nil {
+				d.Type = NamedTypeRef{Name: *name}
 			} else {
-				d.Type = t1
+				d.Type = t
 			}
 
 			dl.Decls = append(dl.Decls, d)
 
-			if !p.maybe(lexer.Comma) {
+			if !p.maybe(lexer.Comma) || p.peek(lexer.RParen) {
 				break
 			}
 		}
 	}
 	p.expect("Unexpected thing in parameter list", lexer.RParen)
-	dl.end = p.t.Position.Move(1)
+	dl.end = p.t.End
 
 	if len(dl.Decls) == 0 {
 		return dl
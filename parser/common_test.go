@@ -1,7 +1,6 @@
 package parser
 
 import "github.com/MerryMage/agi/lexer"
-import "bytes"
 import t "testing"
 
 func dump(t *t.T, o interface{}) {
@@ -9,11 +8,8 @@ func dump(t *t.T, o interface{}) {
 }
 
 func getParser(s string) *Parser {
-	b := bytes.NewBufferString(s)
-	l := lexer.MakeLexer(b, "<test>")
-	p := Parser{}
-	p.l = &l
-	p.nextToken()
+	l := lexer.MakeLexer(lexer.NewFileSet().AddFile("<test>", len(s)), []byte(s))
+	p := MakeParser(&l)
 	return &p
 }
 
@@ -97,3 +93,307 @@ interface {
 	assert(t, i.Fields[1].(InterfaceMethodSpec).Signature.Return.Decls[0].Type.(NamedTypeRef).Name.Name == "bool")
 	assert(t, i.Fields[2].(InterfaceMethodSpec).Signature.Return == nil)
 }
+
+func TestComments(t *t.T) {
+	f := getParser(`// Package doc.
+package p
+
+// Doc for f.
+// More doc.
+func f() // trailing
+
+/* Floating */
+
+func g(x int)
+
+//go:noinline
+// Doc for h.
+func h()
+`).ParseFile()
+	assert(t, f.Doc.Text() == "Package doc.\n")
+	assert(t, len(f.Decls) == 3)
+	assert(t, f.Decls[0].(FuncOrMethodDecl).Doc.Text() == "Doc for f.\nMore doc.\n")
+	assert(t, f.Decls[1].(FuncOrMethodDecl).Doc == nil)
+	assert(t, f.Decls[2].(FuncOrMethodDecl).Doc.Text() == "Doc for h.\n")
+	assert(t, len(f.Decls[2].(FuncOrMethodDecl).Doc.List) == 2)
+	assert(t, len(f.Comments) == 5)
+	assert(t, f.Comments[2].List[0].Text == "// trailing")
+	assert(t, f.Comments[3].Text() == " Floating\n")
+
+	s := getParser(`struct {
+	// Doc for x.
+	x int // x comment
+	// Doc for y.
+	y, z int
+
+	/*
+	   Doc for w.
+	*/
+	w float32
+}`).parseTypeRef().(StructTypeRef)
+	assert(t, len(s.Fields) == 3)
+	assert(t, s.Fields[0].Doc.Text() == "Doc for x.\n")
+	assert(t, s.Fields[1].Doc.Text() == "Doc for y.\n")
+	assert(t, s.Fields[2].Doc.Text() == "\t   Doc for w.\n")
+
+	i := getParser(`interface {
+	// Doc for Read.
+	Read(b Buffer) bool
+	Close() // not a doc comment
+	Write(b Buffer) bool
+}`).parseTypeRef().(InterfaceTypeRef)
+	assert(t, i.Fields[0].(InterfaceMethodSpec).Doc.Text() == "Doc for Read.\n")
+	assert(t, i.Fields[1].(InterfaceMethodSpec).Doc == nil)
+	assert(t, i.Fields[2].(InterfaceMethodSpec).Doc == nil)
+}
+
+func TestDirectives(t *t.T) {
+	f := getParser(`package p
+
+import "embed"
+
+// Sum adds.
+//go:noinline
+func Sum(a, b int) int
+
+//agi:dotnet method [mscorlib]System.Math.Abs
+func abs(x int) int
+
+//go:linkname now runtime.now
+func now() int64
+
+//go:embed hello.txt "with space.txt"
+var content embed.FS
+
+//agi:dotnet serializable
+type Point struct { X, Y int }
+
+type (
+	A = int
+	B []A
+)
+
+var x, y int
+
+var (
+	//go:embed hello.txt
+	hello embed.FS
+	z     int
+)
+
+type (
+	//agi:dotnet serializable
+	T struct{}
+)
+`).ParseFile()
+	assert(t, len(f.Decls) == 9)
+
+	sum := f.Decls[0].(FuncOrMethodDecl)
+	assert(t, sum.Doc.Text() == "Sum adds.\n")
+	assert(t, len(sum.Directives) == 1)
+	assert(t, sum.Directives[0].Namespace == "go" && sum.Directives[0].Name == "noinline")
+
+	abs := f.Decls[1].(FuncOrMethodDecl)
+	assert(t, abs.Directives[0].Namespace == "agi" && abs.Directives[0].Name == "dotnet")
+	assert(t, abs.Directives[0].Args[0] == "method")
+	assert(t, abs.Directives[0].Args[1] == "[mscorlib]System.Math.Abs")
+
+	assert(t, f.Decls[2].(FuncOrMethodDecl).Directives[0].Args[1] == "runtime.now")
+
+	content := f.Decls[3].(VarDecl)
+	assert(t, len(content.Directives[0].Args) == 2)
+	assert(t, content.Directives[0].Args[1] == "with space.txt")
+	assert(t, content.Specs[0].Type.(NamedTypeRef).Name.Name == "FS")
+
+	point := f.Decls[4].(TypeDecl)
+	assert(t, point.Directives[0].Args[0] == "serializable")
+	assert(t, point.Specs[0].Name.Name == "Point")
+
+	group := f.Decls[5].(TypeDecl)
+	assert(t, len(group.Specs) == 2)
+	assert(t, group.Specs[0].IsAlias && !group.Specs[1].IsAlias)
+
+	assert(t, len(f.Decls[6].(VarDecl).Specs[0].Names) == 2)
+
+	// Specs in parentheses have their own directives
+	hello := f.Decls[7].(VarDecl)
+	assert(t, len(hello.Directives) == 0)
+	assert(t, hello.Specs[0].Directives[0].Name == "embed" && hello.Specs[0].Directives[0].Args[0] == "hello.txt")
+	assert(t, len(hello.Specs[1].Directives) == 0)
+	assert(t, f.Decls[8].(TypeDecl).Specs[0].Directives[0].Args[0] == "serializable")
+
+	// Like gc, directives apply to the next declaration even after a blank
+	// line, and are ignored anywhere else
+	spaced := getParser("package p\n\n//go:noinline\n\n// f is documented.\nfunc f()\n").ParseFile().Decls[0].(FuncOrMethodDecl)
+	assert(t, len(spaced.Directives) == 1 && spaced.Doc.Text() == "f is documented.\n")
+	field := getParser("package p\n\ntype T struct {\n\t//go:noinline\n\tx int\n}\n\n//go:noinline\n").ParseFile()
+	assert(t, len(field.Decls[0].(TypeDecl).Directives) == 0)
+	trailing := getParser("package p\n\nvar x int //go:noinline\nfunc f()\n").ParseFile()
+	assert(t, len(trailing.Decls[1].(FuncOrMethodDecl).Directives) == 0)
+
+	// Unknown //go: directives are for other tools
+	assert(t, len(getParser("package p\n\n//go:generate stringer\nfunc f()\n").ParseFile().Decls[0].(FuncOrMethodDecl).Directives) == 0)
+
+	shouldPanic(t, func() { getParser("package p\n\n//agi:unknown\nfunc f()\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\n//go:noinline\ntype T int\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\n//go:noinline x\nfunc f()\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\n//go:linkname g runtime.g\nfunc f()\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\n//go:embed x.txt\nvar s string\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\nimport \"embed\"\n\n//go:embed x.txt\nvar a, b string\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\n//agi:dotnet method\nfunc f()\n").ParseFile() })
+	withEmbed := "package p\nimport \"embed\"\n\n"
+	shouldPanic(t, func() { getParser(withEmbed + "var (\n\t//go:embed x.txt\n\ta, b string\n)\n").ParseFile() })
+	shouldPanic(t, func() { getParser(withEmbed + "var (\n\t//go:embed x.txt\n\ts = \"\"\n)\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\nvar (\n\t//go:embed x.txt\n\ts string\n)\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\ntype (\n\t//go:embed x.txt\n\tT int\n)\n").ParseFile() })
+}
+
+func TestGenerics(t *t.T) {
+	f := getParser(`package p
+
+func Map[S ~[]E, E, R any](s S, f func(E) R) []R
+
+func (l *List[T]) Push(v T)
+
+type List[T any] struct {
+	head *node[T]
+	arr  [N]T
+	s    []T
+	m    Pair[string, T]
+}
+
+type Number interface {
+	~int | ~int64 | float64
+	Stringer
+	fmt.Stringer
+	List[int]
+	String() string
+}
+
+type Array [N]int
+
+type Set[K comparable, V interface{ ~int | ~uint }] map[K]V
+`).ParseFile()
+
+	m := f.Decls[0].(FuncOrMethodDecl)
+	assert(t, len(m.TypeParams.Params) == 3)
+	assert(t, m.TypeParams.Params[0].Name.Name == "S")
+	assert(t, m.TypeParams.Params[0].Constraint.(UnionTypeRef).Terms[0].Tilde)
+	assert(t, m.TypeParams.Params[0].Constraint.(UnionTypeRef).Terms[0].Type.(SliceTypeRef).ElemType.(NamedTypeRef).Name.Name == "E")
+	assert(t, m.TypeParams.Params[1].Constraint.(NamedTypeRef).Name.Name == "any")
+	assert(t, m.TypeParams.Params[2].Constraint.(NamedTypeRef).Name.Name == "any")
+
+	push := f.Decls[1].(FuncOrMethodDecl)
+	assert(t, push.TypeParams == nil)
+	recv := push.Receiver.Decls[0].Type.(PointerTypeRef).BaseType.(NamedTypeRef)
+	assert(t, recv.Name.Name == "List" && recv.TypeArgs[0].(NamedTypeRef).Name.Name == "T")
+
+	list := f.Decls[2].(TypeDecl).Specs[0]
+	assert(t, list.TypeParams.Params[0].Name.Name == "T")
+	fields := list.Type.(StructTypeRef).Fields
+	assert(t, fields[0].Type.(PointerTypeRef).BaseType.(NamedTypeRef).TypeArgs != nil)
+	assert(t, (*fields[1].Names)[0].Name == "arr")
+	assert(t, fields[1].Type.(ArrayTypeRef).ElemType.(NamedTypeRef).Name.Name == "T")
+	assert(t, (*fields[2].Names)[0].Name == "s")
+	assert(t, len(fields[3].Type.(NamedTypeRef).TypeArgs) == 2)
+
+	number := f.Decls[3].(TypeDecl).Specs[0].Type.(InterfaceTypeRef)
+	assert(t, len(number.Fields) == 5)
+	union := number.Fields[0].(UnionTypeRef)
+	assert(t, len(union.Terms) == 3)
+	assert(t, union.Terms[1].Tilde && !union.Terms[2].Tilde)
+	assert(t, number.Fields[1].(NamedTypeRef).Name.Name == "Stringer")
+	assert(t, number.Fields[2].(NamedTypeRef).Package.Name == "fmt")
+	assert(t, number.Fields[3].(NamedTypeRef).TypeArgs != nil)
+	assert(t, number.Fields[4].(InterfaceMethodSpec).MethodName.Name == "String")
+
+	array := f.Decls[4].(TypeDecl).Specs[0]
+	assert(t, array.TypeParams == nil)
+	assert(t, array.Type.(ArrayTypeRef).ElemType.(NamedTypeRef).Name.Name == "int")
+
+	set := f.Decls[5].(TypeDecl).Specs[0]
+	assert(t, len(set.TypeParams.Params) == 2)
+	assert(t, set.TypeParams.Params[1].Constraint.(InterfaceTypeRef).Fields[0].(UnionTypeRef).Terms[1].Tilde)
+
+	// Parameter names followed by slice and array types are not instantiations
+	sig := getParser("(a []int, b [4]int, c [N]int)").parseParameterDeclList(false)
+	assert(t, sig.Decls[0].Name.Name == "a")
+	assert(t, sig.Decls[1].Name.Name == "b")
+	assert(t, sig.Decls[2].Name.Name == "c")
+	sig = getParser("(List[int], Map[K, V])").parseParameterDeclList(false)
+	assert(t, sig.Decls[0].Name == nil && sig.Decls[0].Type.(NamedTypeRef).Name.Name == "List")
+	assert(t, len(sig.Decls[1].Type.(NamedTypeRef).TypeArgs) == 2)
+
+	shouldPanic(t, func() { getParser("package p\nfunc (l *List[T]) Push[U any]()\n").ParseFile() })
+
+	// [P *C] and [P (C)] are array lengths, which aren't supported; a comma or
+	// a constraint which can't be an expression makes them type parameters
+	shouldPanic(t, func() { getParser("package p\ntype T[P *C] X\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\ntype T[P *C | D] X\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\ntype T[P (C)] X\n").ParseFile() })
+	for _, src := range []string{"[P *C,]", "[P *[]int]", "[P *C | ~int]", "[P ([]C)]", "[P C]"} {
+		tp := getParser("package p\ntype T" + src + " X\n").ParseFile().Decls[0].(TypeDecl).Specs[0].TypeParams
+		assert(t, tp != nil && len(tp.Params) == 1)
+	}
+}
+
+func TestPositions(t *t.T) {
+	src := "package p\n\ntype (\n\tS struct{ x int }\n\tI interface{ M() }\n)\n\nfunc f(a []int) (b int)\n"
+	p := getParser(src)
+	f := p.ParseFile()
+	file := p.l.File()
+	text := func(n ASTNode) string {
+		return src[file.Offset(n.Begin()):file.Offset(n.End())]
+	}
+
+	td := f.Decls[0].(TypeDecl)
+	assert(t, text(td) == "type (\n\tS struct{ x int }\n\tI interface{ M() }\n)")
+	assert(t, text(td.Specs[0]) == "S struct{ x int }")
+	assert(t, text(td.Specs[1].Type) == "interface{ M() }")
+	fd := f.Decls[1].(FuncOrMethodDecl)
+	assert(t, text(fd) == "func f(a []int) (b int)")
+	assert(t, text(fd.Signature.Args.Decls[0]) == "a []int")
+	assert(t, file.Position(fd.FunctionName.Begin()).String() == "<test>:8:6")
+
+	defer func() {
+		assert(t, recover() == "<test>:2:12 - a function name was expected here")
+	}()
+	getParser("package p\nfunc (x T) () {}").ParseFile()
+}
+
+func TestFuncDecl(t *t.T) {
+	f := getParser("package p\n\nfunc f(x int) bool\nfunc (r *T) M() (n int)\n").ParseFile()
+
+	fn := f.Decls[0].(FuncOrMethodDecl)
+	assert(t, fn.Receiver == nil && fn.FunctionName.Name == "f")
+	assert(t, fn.Signature.Args.Decls[0].Name.Name == "x")
+
+	// The receiver's "(" starts its parameter list
+	m := f.Decls[1].(FuncOrMethodDecl)
+	assert(t, m.FunctionName.Name == "M" && len(m.Receiver.Decls) == 1)
+	assert(t, m.Receiver.Decls[0].Name.Name == "r")
+	assert(t, m.Receiver.Decls[0].Type.(PointerTypeRef).BaseType.(NamedTypeRef).Name.Name == "T")
+	assert(t, m.Signature.Return.Decls[0].Name.Name == "n")
+
+	shouldPanic(t, func() { getParser("package p\n\nfunc (a, b T) M()\n").ParseFile() })
+	shouldPanic(t, func() { getParser("package p\n\nfunc () M()\n").ParseFile() })
+}
+
+// Expressions aren't parsed yet, so only single-token initializers are accepted.
+func TestVarInitializers(t *t.T) {
+	d := getParser("package p\n\nvar a, b, c = 1, \"s\", x\n").ParseFile().Decls[0].(VarDecl)
+	assert(t, len(d.Specs[0].Values) == 3 && d.Specs[0].Values[1].Text == `"s"`)
+
+	for src, msg := range map[string]string{
+		"var x = 1 + 2": "<test>:1:9 - only expressions of a single name or literal are supported yet",
+		"var x = f()":   "<test>:1:9 - only expressions of a single name or literal are supported yet",
+		"var x = -1":    "<test>:1:9 - an expression was expected here",
+	} {
+		func() {
+			defer func() {
+				assert(t, recover() == msg)
+			}()
+			getParser(src).parseVarDecl()
+		}()
+	}
+}
@@ -11,15 +11,18 @@ type Decl interface {
 // Parse Function or Method Decl
 
 type FuncOrMethodDecl struct {
-	begin        lexer.Position
+	Doc          *CommentGroup
+	Directives   []Directive
+	begin        lexer.Pos
 	Receiver     *ParameterDeclList // If this exists, it's a method. Otherwise, it's a function.
 	FunctionName Identifier
+	TypeParams   *TypeParamList // If this exists, it's a generic function
 	Signature    FunctionSignature
 	Body         *Block
 }
 
-func (o FuncOrMethodDecl) Begin() lexer.Position { return o.begin }
-func (o FuncOrMethodDecl) End() lexer.Position {
+func (o FuncOrMethodDecl) Begin() lexer.Pos { return o.begin }
+func (o FuncOrMethodDecl) End() lexer.Pos {
 	if o.Body != nil {
 		return o.Body.End()
 	} else {
@@ -30,7 +33,7 @@ func (o FuncOrMethodDecl) _astNode() {}
 func (o FuncOrMethodDecl) _decl()    {}
 
 /*
-	FunctionDecl = "func" FunctionName ( Function | Signature ) .
+	FunctionDecl = "func" FunctionName [ TypeParameters ] ( Function | Signature ) .
 	FunctionName = identifier .
 	Function     = Signature FunctionBody .
 	FunctionBody = Block .
@@ -43,10 +46,12 @@ func (o FuncOrMethodDecl) _decl()    {}
 func (p *Parser) parseFuncOrMethodDecl() FuncOrMethodDecl {
 	var d FuncOrMethodDecl
 
+	d.Directives = p.parseDirectives(p.leadingComments(), funcTarget)
 	p.expect("ICE", lexer.FuncKeyword)
-	d.begin = p.t.Position
+	d.Doc = p.doc
+	d.begin = p.t.Pos
 
-	if p.maybe(lexer.LParen) {
+	if p.peek(lexer.LParen) {
 		// A method
 		dl := p.parseParameterDeclList(true)
 		d.Receiver = &dl
@@ -60,9 +65,19 @@ func (p *Parser) parseFuncOrMethodDecl() FuncOrMethodDecl {
 		d.Receiver = nil
 	}
 
-	p.expect("a function name was expected here", lexer.Identifier)
+	if !p.peek(lexer.Identifier) {
+		p.expect("a function name was expected here", lexer.Identifier)
+	}
 	d.FunctionName = p.parseIdentifier()
 
+	if p.maybe(lexer.LBracket) {
+		if d.Receiver != nil {
+			panic("methods cannot have type parameters")
+		}
+		tl := p.parseTypeParamList(p.t.Pos, nil)
+		d.TypeParams = &tl
+	}
+
 	d.Signature = p.parseFunctionSignature(true)
 
 	if p.maybe(lexer.LBrace) {
@@ -76,5 +91,198 @@ func (p *Parser) parseFuncOrMethodDecl() FuncOrMethodDecl {
 		panic("Expected a function body here")
 	}
 
+	p.checkDirectives(d.Directives, []Identifier{d.FunctionName}, d)
+	return d
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Parse Type Decl
+
+type TypeDecl struct {
+	Doc        *CommentGroup
+	Directives []Directive
+	begin      lexer.Pos
+	lparen     lexer.Pos // NoPos unless the specs are in parentheses
+	Specs      []TypeSpec
+	end        lexer.Pos
+}
+
+func (o TypeDecl) Begin() lexer.Pos { return o.begin }
+func (o TypeDecl) End() lexer.Pos   { return o.end }
+func (o TypeDecl) _astNode()        {}
+func (o TypeDecl) _decl()           {}
+
+type TypeSpec struct {
+	Doc        *CommentGroup // Only in parentheses; otherwise it belongs to the TypeDecl
+	Directives []Directive
+	Name       Identifier
+	TypeParams *TypeParamList // If this exists, it's a generic type
+	IsAlias    bool           // type Name = Type
+	Type       TypeRef
+}
+
+func (o TypeSpec) Begin() lexer.Pos { return o.Name.Begin() }
+func (o TypeSpec) End() lexer.Pos   { return o.Type.End() }
+func (o TypeSpec) _astNode()        {}
+
+/*
+	TypeDecl  = "type" ( TypeSpec | "(" { TypeSpec ";" } ")" ) .
+	TypeSpec  = AliasDecl | TypeDef .
+	AliasDecl = identifier [ TypeParameters ] "=" Type .
+	TypeDef   = identifier [ TypeParameters ] Type .
+
+	"type A [N]T" is an array type, not a type parameter list: a type parameter
+	always has a constraint. Nor is "type A [P *C]T": a single parameter whose
+	constraint could be read as an expression is an array length, unless it's
+	followed by a comma.
+*/
+
+func (p *Parser) parseTypeDecl() TypeDecl {
+	var d TypeDecl
+
+	d.Directives = p.parseDirectives(p.leadingComments(), typeTarget)
+	p.expect("ICE", lexer.TypeKeyword)
+	d.Doc = p.doc
+	d.begin = p.t.Pos
+
+	parseTypeSpec := func() (s TypeSpec) {
+		s.Doc = p.peekDoc
+		s.Directives = p.parseDirectives(p.leadingComments(), typeTarget)
+		s.Name = p.parseIdentifier()
+		if p.maybe(lexer.LBracket) {
+			begin := p.t.Pos
+			if !p.peek(lexer.Identifier) {
+				s.Type = p.parseBracketTypeRef(begin)
+				return
+			}
+			first := p.parseIdentifier()
+			if p.maybe(lexer.RBracket) {
+				// type A [N]T
+				inner := p.parseTypeRef()
+				length := namedTypeRefExpr(NamedTypeRef{Name: first})
+				s.Type = ArrayTypeRef{begin: begin, Length: length, ElemType: inner}
+				return
+			}
+			paren := p.peek(lexer.LParen)
+			tl := p.parseTypeParamList(begin, &first)
+			if len(tl.Params) == 1 && !tl.trailingComma {
+				// type A [P *C]T and type A [P (C)]T are arrays of length P*C and P(C)
+				if c := tl.Params[0].Constraint; combinesWithName(c) || paren && !isTypeElem(c) {
+					p.panicAt(begin, "array lengths which aren't a single token aren't supported yet (add a comma for a type parameter list: [P *C,])")
+				}
+			}
+			s.TypeParams = &tl
+		}
+		s.IsAlias = p.maybe(lexer.AssignOp)
+		s.Type = p.parseTypeRef()
+		return
+	}
+	addTypeSpec := func(s TypeSpec) {
+		p.checkDirectives(s.Directives, []Identifier{s.Name}, s)
+		d.Specs = append(d.Specs, s)
+	}
+
+	if p.maybe(lexer.LParen) {
+		d.lparen = p.t.Pos
+		for !p.maybe(lexer.RParen) {
+			addTypeSpec(parseTypeSpec())
+			p.expectSemicolon("expected ; after type specification")
+		}
+		d.end = p.t.End
+	} else {
+		addTypeSpec(parseTypeSpec())
+		d.end = d.Specs[0].End()
+	}
+
+	var names []Identifier
+	for _, s := range d.Specs {
+		names = append(names, s.Name)
+	}
+	p.checkDirectives(d.Directives, names, d)
+	return d
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Parse Var Decl
+
+type VarDecl struct {
+	Doc        *CommentGroup
+	Directives []Directive
+	begin      lexer.Pos
+	lparen     lexer.Pos // NoPos unless the specs are in parentheses
+	Specs      []VarSpec
+	end        lexer.Pos
+}
+
+func (o VarDecl) Begin() lexer.Pos { return o.begin }
+func (o VarDecl) End() lexer.Pos   { return o.end }
+func (o VarDecl) _astNode()        {}
+func (o VarDecl) _decl()           {}
+
+type VarSpec struct {
+	Doc        *CommentGroup // Only in parentheses; otherwise it belongs to the VarDecl
+	Directives []Directive
+	Names      []Identifier
+	Type       TypeRef // If not present, inferred from Values
+	Values     []Expr
+	end        lexer.Pos
+}
+
+func (o VarSpec) Begin() lexer.Pos { return o.Names[0].Begin() }
+func (o VarSpec) End() lexer.Pos   { return o.end }
+func (o VarSpec) _astNode()        {}
+
+/*
+	VarDecl = "var" ( VarSpec | "(" { VarSpec ";" } ")" ) .
+	VarSpec = IdentifierList ( Type [ "=" ExpressionList ] | "=" ExpressionList ) .
+*/
+
+func (p *Parser) parseVarDecl() VarDecl {
+	var d VarDecl
+
+	d.Directives = p.parseDirectives(p.leadingComments(), varTarget)
+	p.expect("ICE", lexer.VarKeyword)
+	d.Doc = p.doc
+	d.begin = p.t.Pos
+
+	parseVarSpec := func() {
+		var s VarSpec
+		s.Doc = p.peekDoc
+		s.Directives = p.parseDirectives(p.leadingComments(), varTarget)
+		s.Names = append(s.Names, p.parseIdentifier())
+		for p.maybe(lexer.Comma) {
+			s.Names = append(s.Names, p.parseIdentifier())
+		}
+		if !p.peek(lexer.AssignOp) {
+			s.Type = p.parseTypeRef()
+		}
+		if p.maybe(lexer.AssignOp) {
+			s.Values = append(s.Values, p.parseExpr())
+			for p.maybe(lexer.Comma) {
+				s.Values = append(s.Values, p.parseExpr())
+			}
+		}
+		s.end = p.t.End
+		p.checkDirectives(s.Directives, s.Names, s)
+		d.Specs = append(d.Specs, s)
+	}
+
+	if p.maybe(lexer.LParen) {
+		d.lparen = p.t.Pos
+		for !p.maybe(lexer.RParen) {
+			parseVarSpec()
+			p.expectSemicolon("expected ; after var specification")
+		}
+		d.end = p.t.End
+	} else {
+		parseVarSpec()
+		d.end = d.Specs[0].End()
+	}
+
+	var names []Identifier
+	for _, s := range d.Specs {
+		names = append(names, s.Names...)
+	}
+	p.checkDirectives(d.Directives, names, d)
 	return d
 }
@@ -0,0 +1,219 @@
+package parser
+
+import "github.com/MerryMage/agi/lexer"
+import "fmt"
+import "strconv"
+import "strings"
+
+////////////////////////////////////////////////////////////////////////////////
+// Directives
+//   Line comments of the form "//go:name args" or "//agi:name args" that
+//   control code generation. Like gc, a directive applies to the declaration
+//   (or var or type spec in parentheses) that follows it, even if it's
+//   separated from it by blank lines or other comments. Directives anywhere
+//   else, such as on struct fields, are ignored.
+//
+//   //go:noinline                                        (func)
+//   //go:linkname localname [importpath.name]            (func, var)
+//   //go:embed patterns...                               (var)
+//   //agi:dotnet method [Assembly]Namespace.Type.Method  (func without a body)
+//   //agi:dotnet serializable                            (type)
+
+type Directive struct {
+	pos       lexer.Pos
+	Namespace string // "go" or "agi"
+	Name      string
+	Args      []string
+	end       lexer.Pos
+}
+
+func (d Directive) Begin() lexer.Pos { return d.pos }
+func (d Directive) End() lexer.Pos   { return d.end }
+func (d Directive) _astNode()        {}
+
+func (d Directive) String() string {
+	return "//" + d.Namespace + ":" + strings.Join(append([]string{d.Name}, d.Args...), " ")
+}
+
+// Which declarations a directive may be attached to
+type directiveTarget int
+
+const (
+	funcTarget directiveTarget = 1 << iota
+	varTarget
+	typeTarget
+)
+
+var directiveTargets = map[string]directiveTarget{
+	"go:noinline":             funcTarget,
+	"go:linkname":             funcTarget | varTarget,
+	"go:embed":                varTarget,
+	"agi:dotnet method":       funcTarget,
+	"agi:dotnet serializable": typeTarget,
+}
+
+func (d Directive) key() string {
+	if d.Namespace == "agi" && d.Name == "dotnet" && len(d.Args) > 0 {
+		return "agi:dotnet " + d.Args[0]
+	}
+	return d.Namespace + ":" + d.Name
+}
+
+// Parses a comment into a directive, if it is one we care about.
+// Unknown //go: directives are left for other tools (e.g. //go:build, //go:generate).
+func (p *Parser) parseDirective(c Comment) (Directive, bool) {
+	if !strings.HasPrefix(c.Text, "//") || !isDirective(c.Text[2:]) {
+		return Directive{}, false
+	}
+
+	text := c.Text[2:]
+	colon := strings.Index(text, ":")
+	d := Directive{pos: c.pos, Namespace: text[:colon], end: c.End()}
+	fields := p.splitDirectiveArgs(c, text[colon+1:])
+	d.Name, d.Args = fields[0], fields[1:]
+
+	switch d.Namespace {
+	case "go":
+		if _, ok := directiveTargets[d.key()]; !ok {
+			return Directive{}, false
+		}
+	case "agi":
+		if _, ok := directiveTargets[d.key()]; !ok {
+			p.panicAt(d.pos, fmt.Sprintf("unknown directive %s", d))
+		}
+	default:
+		return Directive{}, false
+	}
+	return d, true
+}
+
+// Arguments are separated by spaces; they may be quoted like Go strings.
+func (p *Parser) splitDirectiveArgs(c Comment, text string) []string {
+	var args []string
+	for {
+		text = strings.TrimLeft(text, " \t")
+		if text == "" {
+			return args
+		}
+		end := strings.IndexAny(text, " \t")
+		if text[0] == '"' || text[0] == '`' {
+			// Find the closing quote, skipping over escapes
+			end = -1
+			for i := 1; i < len(text); i++ {
+				if text[0] == '"' && text[i] == '\\' {
+					i++
+				} else if text[i] == text[0] {
+					end = i + 1
+					break
+				}
+			}
+			if end == -1 {
+				p.panicAt(c.pos, "unterminated quoted argument in directive")
+			}
+			arg, err := strconv.Unquote(text[:end])
+			if err != nil {
+				p.panicAt(c.pos, "invalid quoted argument in directive")
+			}
+			args = append(args, arg)
+			text = text[end:]
+			continue
+		}
+		if end == -1 {
+			end = len(text)
+		}
+		args = append(args, text[:end])
+		text = text[end:]
+	}
+}
+
+// The comment groups between p.t and p.peekt, apart from a trailing comment
+// on p.t's line: those which may hold directives for a declaration at p.peekt.
+func (p *Parser) leadingComments() []*CommentGroup {
+	i := len(p.comments)
+	for i > 0 && p.comments[i-1].Begin() > p.t.Pos && p.line(p.comments[i-1].Begin()) > p.line(p.t.Pos) {
+		i--
+	}
+	return p.comments[i:]
+}
+
+// Extracts the directives from the comments before a declaration, checking
+// that they may be attached to this kind of declaration.
+func (p *Parser) parseDirectives(groups []*CommentGroup, target directiveTarget) []Directive {
+	var ds []Directive
+	for _, g := range groups {
+		for _, c := range g.List {
+			d, ok := p.parseDirective(c)
+			if !ok {
+				continue
+			}
+			if directiveTargets[d.key()]&target == 0 {
+				p.panicAt(d.pos, fmt.Sprintf("misplaced compiler directive %s", d))
+			}
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// Validates the arguments of each directive against the declaration or spec
+// it's attached to.
+func (p *Parser) checkDirectives(ds []Directive, names []Identifier, decl ASTNode) {
+	for _, d := range ds {
+		switch d.key() {
+		case "go:noinline":
+			if len(d.Args) != 0 {
+				p.panicAt(d.pos, "usage: //go:noinline")
+			}
+		case "go:linkname":
+			if len(d.Args) != 1 && len(d.Args) != 2 {
+				p.panicAt(d.pos, "usage: //go:linkname localname [importpath.name]")
+			}
+			found := false
+			for _, n := range names {
+				found = found || n.Name == d.Args[0]
+			}
+			if !found {
+				p.panicAt(d.pos, fmt.Sprintf("//go:linkname refers to %s, which is not declared here", d.Args[0]))
+			}
+		case "go:embed":
+			if len(d.Args) == 0 {
+				p.panicAt(d.pos, "usage: //go:embed pattern...")
+			}
+			var specs []VarSpec
+			switch decl := decl.(type) {
+			case VarDecl:
+				specs = decl.Specs
+			case VarSpec:
+				specs = []VarSpec{decl}
+			}
+			if len(specs) != 1 || len(specs[0].Names) != 1 {
+				p.panicAt(d.pos, "//go:embed cannot apply to multiple vars")
+			} else if specs[0].Type == nil {
+				p.panicAt(d.pos, "//go:embed requires a var with a type")
+			} else if len(specs[0].Values) != 0 {
+				p.panicAt(d.pos, "//go:embed cannot apply to var with initializer")
+			}
+		case "agi:dotnet method":
+			if len(d.Args) != 2 {
+				p.panicAt(d.pos, "usage: //agi:dotnet method [Assembly]Namespace.Type.Method")
+			}
+			if decl.(FuncOrMethodDecl).Body != nil {
+				p.panicAt(d.pos, "//agi:dotnet method can only apply to a function without a body")
+			}
+		case "agi:dotnet serializable":
+			if len(d.Args) != 1 {
+				p.panicAt(d.pos, "usage: //agi:dotnet serializable")
+			}
+		}
+	}
+}
+
+// Returns the first directive with the given namespace and name, if any.
+func findDirective(ds []Directive, namespace, name string) *Directive {
+	for i := range ds {
+		if ds[i].Namespace == namespace && ds[i].Name == name {
+			return &ds[i]
+		}
+	}
+	return nil
+}
@@ -2,12 +2,44 @@ package parser
 
 import "github.com/MerryMage/agi/lexer"
 
-type Expr struct{}
+// Expressions aren't parsed yet: an Expr is a single token, which is kept so
+// that it can be printed.
+type Expr struct {
+	begin lexer.Pos
+	Text  string
+	end   lexer.Pos
+}
+
+func (o Expr) Begin() lexer.Pos { return o.begin }
+func (o Expr) End() lexer.Pos   { return o.end }
+func (o Expr) _astNode()        {}
+
+// The expression naming a constant, as used for an array length.
+func namedTypeRefExpr(o NamedTypeRef) Expr {
+	text := o.Name.Name
+	if o.Package != nil {
+		text = o.Package.Name + "." + text
+	}
+	return Expr{o.Begin(), text, o.End()}
+}
 
 type Block struct{}
 
-func (o Block) End() lexer.Position { panic("unimplemented") }
+func (o Block) End() lexer.Pos { panic("unimplemented") }
 
 func (p *Parser) parseBlock() Block { panic("unimplemented") }
 
-func (p *Parser) parseExpr() Expr { p.nextToken(); return Expr{} }
+// Only an operand which is a single token, a name or a literal, is accepted:
+// "var x = 1 + 2" is an error rather than being misparsed.
+func (p *Parser) parseExpr() Expr {
+	p.nextToken()
+	if p.t.Type != lexer.Identifier && !p.t.IsLiteral() {
+		p.panicAt(p.t.Pos, "an expression was expected here")
+	}
+	switch p.peekt.Type {
+	case lexer.Comma, lexer.Semicolon, lexer.RParen, lexer.RBracket, lexer.RBrace, lexer.EndOfFile:
+	default:
+		p.panicAt(p.t.Pos, "only expressions of a single name or literal are supported yet")
+	}
+	return Expr{p.t.Pos, p.t.SourceCode, p.t.End}
+}
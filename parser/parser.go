@@ -6,8 +6,8 @@ import "github.com/MerryMage/agi/lexer"
 // ASTNode
 
 type ASTNode interface {
-	Begin() lexer.Position
-	End() lexer.Position
+	Begin() lexer.Pos
+	End() lexer.Pos
 	_astNode()
 }
 
@@ -18,22 +18,60 @@ type Parser struct {
 	l     *lexer.Lexer
 	t     lexer.Token // Current Token
 	peekt lexer.Token // One Token Lookahead
+
+	comments []*CommentGroup // All comments seen so far
+	doc      *CommentGroup   // Doc comment for p.t
+	peekDoc  *CommentGroup   // Doc comment for p.peekt
+}
+
+func MakeParser(l *lexer.Lexer) Parser {
+	p := Parser{}
+	p.l = l
+	p.nextToken()
+	return p
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // Parse File
 
 type File struct {
+	Doc         *CommentGroup
+	begin       lexer.Pos
 	PackageName string
-	Imports     []Import
+	ImportDecls []ImportDecl
+	Imports     []Import // The specs of every ImportDecl
 	Decls       []Decl
+	Comments    []*CommentGroup // Every comment in the file, in order
+	end         lexer.Pos
+}
+
+func (o File) Begin() lexer.Pos { return o.begin }
+func (o File) End() lexer.Pos   { return o.end }
+func (o File) _astNode()        {}
+
+type ImportDecl struct {
+	Doc    *CommentGroup
+	begin  lexer.Pos
+	lparen lexer.Pos // NoPos unless the specs are in parentheses
+	Specs  []Import
+	end    lexer.Pos
 }
 
+func (o ImportDecl) Begin() lexer.Pos { return o.begin }
+func (o ImportDecl) End() lexer.Pos   { return o.end }
+func (o ImportDecl) _astNode()        {}
+
 type Import struct {
+	begin           lexer.Pos
 	PackageNickname string
 	ImportPath      string
+	end             lexer.Pos
 }
 
+func (o Import) Begin() lexer.Pos { return o.begin }
+func (o Import) End() lexer.Pos   { return o.end }
+func (o Import) _astNode()        {}
+
 /*
 	SourceFile       = PackageClause ";" { ImportDecl ";" } { TopLevelDecl ";" } .
 */
@@ -45,11 +83,15 @@ func (p *Parser) ParseFile() File {
 		PackageName    = identifier .
 	*/
 	p.expect("a Go file must start with a 'package' declaration.", lexer.PackageKeyword)
+	f.Doc = p.doc
+	f.begin = p.t.Pos
 	p.expect("expected a package name after 'package'", lexer.Identifier)
 	f.PackageName = p.t.Payload.(string)
 	p.expect("a package name is a single identifier", lexer.Semicolon)
 
 	if p.maybe(lexer.EndOfFile) {
+		f.Comments = p.comments
+		f.end = p.t.Pos
 		return f
 	}
 
@@ -59,9 +101,12 @@ func (p *Parser) ParseFile() File {
 		ImportPath       = string_lit .
 	*/
 	for p.maybe(lexer.ImportKeyword) {
+		d := ImportDecl{Doc: p.doc, begin: p.t.Pos}
+
 		parseImportSpec := func() {
 			var i Import
 
+			i.begin = p.peekt.Pos
 			if p.maybe(lexer.Dot) {
 				i.PackageNickname = "."
 			} else if p.maybe(lexer.Identifier) {
@@ -70,31 +115,66 @@ func (p *Parser) ParseFile() File {
 
 			p.expect("Malformed import statement", lexer.RawStringLiteral, lexer.InterpretedStringLiteral)
 			i.ImportPath = p.t.Payload.(string)
-			p.expect("One import statment per line please", lexer.Semicolon)
+			i.end = p.t.End
+			p.expectSemicolon("One import statment per line please")
 
-			f.Imports = append(f.Imports, i)
+			d.Specs = append(d.Specs, i)
 		}
 
 		if p.maybe(lexer.LParen) {
-			for p.maybe(lexer.RParen) {
+			d.lparen = p.t.Pos
+			for !p.maybe(lexer.RParen) {
 				parseImportSpec()
 			}
+			d.end = p.t.End
+			p.expect("expected ; after import declaration", lexer.Semicolon)
 		} else {
 			parseImportSpec()
+			d.end = d.Specs[0].End()
 		}
+
+		f.ImportDecls = append(f.ImportDecls, d)
+		f.Imports = append(f.Imports, d.Specs...)
 	}
 
-	for !p.maybe(lexer.EndOfFile) {
+	for {
 		for p.maybe(lexer.Semicolon) {
 			// empty
 		}
+		if p.maybe(lexer.EndOfFile) {
+			break
+		}
 		d := p.ParseTopLevel()
 		f.Decls = append(f.Decls, d)
 	}
 
+	p.checkEmbedImport(f)
+
+	f.Comments = p.comments
+	f.end = p.t.Pos
 	return f
 }
 
+// //go:embed is only allowed in files that import "embed".
+func (p *Parser) checkEmbedImport(f File) {
+	for _, i := range f.Imports {
+		if i.ImportPath == "embed" {
+			return
+		}
+	}
+	for _, d := range f.Decls {
+		if vd, ok := d.(VarDecl); ok {
+			ds := vd.Directives
+			for _, s := range vd.Specs {
+				ds = append(ds, s.Directives...)
+			}
+			if e := findDirective(ds, "go", "embed"); e != nil {
+				p.panicAt(e.pos, "//go:embed only allowed in Go files that import \"embed\"")
+			}
+		}
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Parse Top Level
 
@@ -109,11 +189,9 @@ func (p *Parser) ParseTopLevel() Decl {
 		panic("unimplemented")
 		// return p.parseConstDecl()
 	} else if p.peek(lexer.TypeKeyword) {
-		panic("unimplemented")
-		// return p.parseTypeDecl()
+		return p.parseTypeDecl()
 	} else if p.peek(lexer.VarKeyword) {
-		panic("unimplemented")
-		// return p.parseVarDecl()
+		return p.parseVarDecl()
 	} else {
 		panic("Did not expect *this* weirdness at toplevel")
 	}
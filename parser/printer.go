@@ -0,0 +1,972 @@
+package parser
+
+import "github.com/MerryMage/agi/lexer"
+import "bytes"
+import "fmt"
+import "go/doc/comment"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+import "text/tabwriter"
+
+////////////////////////////////////////////////////////////////////////////////
+// Printer
+//   Prints a File in the same format as gofmt.
+//
+//   Output goes through a tabwriter configured the same way as gofmt's:
+//   indentation is written as '\t', cells to be aligned are terminated by '\v',
+//   and '\f' is a line break which also ends the current alignment section.
+//   Comments and string literals are escaped so their contents don't affect
+//   alignment.
+//
+//   Comments are interspersed by position: before each line-level item
+//   (declaration, spec, field, ...) is printed, every comment which begins
+//   before it is printed. Comments within a line are moved to the next line
+//   break.
+
+type printer struct {
+	file     *lexer.File
+	comments []*CommentGroup
+	cindex   int // Index of the next comment group to be printed
+
+	buf       bytes.Buffer
+	indent    int
+	lineStart bool // Indentation is pending
+	outLines  int  // Number of line breaks written
+	line      int  // Source line of the last thing printed
+	hasSep    bool // A separator has already been written for a trailing comment
+
+	// Trailing comments of imports which have been moved by sorting
+	movedComments map[lexer.Pos]*CommentGroup // By the new position of the import
+	skipComments  map[*CommentGroup]bool
+}
+
+func Fprint(w io.Writer, file *lexer.File, f File) error {
+	p := printer{file: file, comments: f.Comments}
+	p.movedComments = make(map[lexer.Pos]*CommentGroup)
+	p.skipComments = make(map[*CommentGroup]bool)
+	p.printFile(f)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', tabwriter.DiscardEmptyColumns|tabwriter.TabIndent|tabwriter.StripEscape)
+	if _, err := tw.Write(p.buf.Bytes()); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// Parses src and prints it in the canonical format.
+// A parse error is returned as an error rather than a panic.
+func Format(filename string, src []byte) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	l := lexer.MakeLexer(lexer.NewFileSet().AddFile(filename, len(src)), src)
+	p := MakeParser(&l)
+	f := p.ParseFile()
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, l.File(), f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Output
+
+func (p *printer) print(s string) {
+	if p.lineStart {
+		for i := 0; i < p.indent; i++ {
+			p.buf.WriteByte('\t')
+		}
+		p.lineStart = false
+	}
+	p.buf.WriteString(s)
+	p.hasSep = false
+}
+
+// Text which mustn't be interpreted by the tabwriter, like comments and strings.
+func (p *printer) printEscaped(s string) {
+	escape := string([]byte{tabwriter.Escape})
+	p.print(escape + s + escape)
+}
+
+// Ends the line n times. A formfeed also ends the current alignment section.
+func (p *printer) newlines(n int, formfeed bool) {
+	if p.buf.Len() == 0 {
+		return // Nothing before the first line
+	}
+	for i := 0; i < n; i++ {
+		if formfeed && i == 0 {
+			p.buf.WriteByte('\f')
+		} else {
+			p.buf.WriteByte('\n')
+		}
+		p.outLines++
+		p.lineStart = true
+	}
+}
+
+func (p *printer) lineOf(pos lexer.Pos) int {
+	return p.file.Line(pos)
+}
+
+// Starts a new line for the item at pos, keeping at most one blank line from
+// the source. Comments before pos are printed first.
+func (p *printer) linebreak(pos lexer.Pos, min int, formfeed bool) {
+	p.breakTo(pos, p.flushComments(pos, min), formfeed)
+}
+
+func (p *printer) breakTo(pos lexer.Pos, min int, formfeed bool) {
+	n := p.lineOf(pos) - p.line
+	if n > 2 {
+		n = 2
+	}
+	if n < min {
+		n = min
+	}
+	p.newlines(n, formfeed)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Comments
+
+// Prints the comments which begin before pos. Returns the minimum number of
+// line breaks needed before the item at pos.
+func (p *printer) flushComments(pos lexer.Pos, min int) int {
+	for p.cindex < len(p.comments) && p.comments[p.cindex].Begin() < pos {
+		if g := p.comments[p.cindex]; !p.skipComments[g] {
+			min = p.printComments(g, min, p.isTopLevelDoc(g, pos))
+		}
+		p.cindex++
+	}
+	return min
+}
+
+// Is g the doc comment of the top-level declaration at pos? That is, does it
+// start in the first column and end on the line just before pos?
+func (p *printer) isTopLevelDoc(g *CommentGroup, pos lexer.Pos) bool {
+	return p.indent == 0 && g.End()+1 == pos && p.file.PositionFor(g.Begin(), false).Column == 1
+}
+
+func (p *printer) printComments(g *CommentGroup, min int, doc bool) int {
+	list := g.List
+	if doc {
+		list = formatDocComment(list)
+	}
+	for i, c := range list {
+		if i > 0 && doc {
+			// The lines of a reformatted doc comment have no positions of their own
+			p.newlines(1, true)
+		} else if p.buf.Len() > 0 && p.lineOf(c.Begin()) == p.line {
+			// A trailing comment, on the same line as the previous item
+			if !p.hasSep {
+				p.print("\t")
+			}
+		} else {
+			p.breakTo(c.Begin(), min, true)
+		}
+
+		for i, text := range strings.Split(c.Text, "\n") {
+			if i > 0 {
+				p.newlines(1, true)
+				p.lineStart = false // The lines of a block comment keep their own indentation
+			}
+			p.printEscaped(strings.TrimRight(text, " \t\r"))
+		}
+		p.line = p.lineOf(c.End())
+
+		// Whatever follows a comment goes on a new line
+		min = 1
+	}
+	p.line = p.lineOf(g.End())
+	return min
+}
+
+// Reformats a doc comment the way gofmt does, by rendering its text through
+// go/doc/comment. Directives are moved to the end of a "//" comment.
+func formatDocComment(list []Comment) []Comment {
+	var kind, text string
+	var directives []Comment
+	if len(list) == 1 && strings.HasPrefix(list[0].Text, "/*") {
+		kind = "/*"
+		text = list[0].Text
+		if !strings.Contains(text, "\n") || allStars(text) {
+			// Reformatting these would only make them worse
+			return list
+		}
+		text = text[2 : len(text)-2]
+	} else if strings.HasPrefix(list[0].Text, "//") {
+		kind = "//"
+		var b strings.Builder
+		for _, c := range list {
+			after, found := strings.CutPrefix(c.Text, "//")
+			if !found {
+				return list
+			}
+			if isDirective(after) || strings.HasPrefix(after, "line ") || strings.HasPrefix(after, "extern ") || strings.HasPrefix(after, "export ") {
+				directives = append(directives, c)
+				continue
+			}
+			b.WriteString(strings.TrimPrefix(after, " "))
+			b.WriteString("\n")
+		}
+		text = b.String()
+	} else {
+		return list
+	}
+	if text == "" {
+		return list
+	}
+
+	var parser comment.Parser
+	var printer comment.Printer
+	text = string(printer.Comment(parser.Parse(text)))
+
+	pos := list[0].pos
+	if kind == "/*" {
+		return []Comment{{pos, "/*\n" + text + "*/"}}
+	}
+	var out []Comment
+	for text != "" {
+		var line string
+		line, text, _ = strings.Cut(text, "\n")
+		if line == "" {
+			line = "//"
+		} else if strings.HasPrefix(line, "\t") {
+			line = "//" + line
+		} else {
+			line = "// " + line
+		}
+		out = append(out, Comment{pos, line})
+	}
+	if len(directives) > 0 {
+		out = append(out, Comment{pos, "//"})
+		for _, c := range directives {
+			out = append(out, Comment{pos, c.Text})
+		}
+	}
+	return out
+}
+
+// Is text the interior of an old-style block comment with a '*' at the start
+// of each line?
+func allStars(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			j := i + 1
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+				j++
+			}
+			if j < len(text) && text[j] != '*' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Is there a comment on the same line as the item ending at end?
+func (p *printer) hasTrailingComment(end lexer.Pos) bool {
+	return p.cindex < len(p.comments) && p.lineOf(p.comments[p.cindex].Begin()) == p.lineOf(end)
+}
+
+// Are there any comments between begin and end?
+func (p *printer) hasCommentsBetween(begin, end lexer.Pos) bool {
+	for _, g := range p.comments[p.cindex:] {
+		if g.Begin() >= end {
+			break
+		} else if g.Begin() > begin {
+			return true
+		}
+	}
+	return false
+}
+
+// If the item ending at end has a trailing comment, writes n separators
+// before it so that it lines up with the comments of the neighbouring items.
+func (p *printer) trailingCells(end lexer.Pos, n int, sep string) {
+	if n == 0 || sep != "\v" || !p.hasTrailingComment(end) {
+		return
+	}
+	for i := 0; i < n; i++ {
+		p.print(sep)
+	}
+	p.hasSep = true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Declarations
+
+func (p *printer) printFile(f File) {
+	p.linebreak(f.Begin(), 0, false)
+	p.print("package " + f.PackageName)
+	p.line = p.lineOf(f.Begin())
+
+	// Declarations of a different kind to the previous one, or with a doc
+	// comment, are separated by a blank line.
+	prev := ""
+	printDecl := func(d ASTNode, tok string, doc *CommentGroup, printIt func()) {
+		min := 1
+		if tok != prev || doc != nil {
+			min = 2
+		}
+		prev = tok
+		p.linebreak(d.Begin(), min, false)
+		printIt()
+		p.line = p.lineOf(d.End())
+	}
+	for _, d := range f.ImportDecls {
+		d := d
+		printDecl(d, "import", d.Doc, func() { p.printImportDecl(d) })
+	}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case FuncOrMethodDecl:
+			printDecl(d, "func", d.Doc, func() { p.printFuncOrMethodDecl(d) })
+		case TypeDecl:
+			printDecl(d, "type", d.Doc, func() { p.printTypeDecl(d) })
+		case VarDecl:
+			printDecl(d, "var", d.Doc, func() { p.printVarDecl(d) })
+		default:
+			panic("ICE: unknown Decl")
+		}
+	}
+
+	p.flushComments(f.End()+1, 1)
+	p.newlines(1, false)
+}
+
+// Prints "(", each item on its own line, then ")". rparen is the position of the ")".
+func (p *printer) printGroup(lparen, rparen lexer.Pos, items []ASTNode, printItem func(i int)) {
+	p.print("(")
+	p.line = p.lineOf(lparen)
+	if len(items) > 0 || p.hasCommentsBetween(lparen, rparen) {
+		p.indent++
+		start := p.outLines
+		for i, item := range items {
+			// An item which spans several lines starts a new alignment section
+			p.linebreak(item.Begin(), 1, i == 0 || p.outLines > start)
+			start = p.outLines
+			printItem(i)
+			p.line = p.lineOf(item.End())
+		}
+		before := p.buf.Len()
+		min := p.flushComments(rparen, 1)
+		p.indent--
+		if p.buf.Len() == before {
+			// Like gofmt, blank lines after the last item are dropped, but
+			// not after a comment
+			p.newlines(1, true)
+		} else {
+			p.breakTo(rparen, min, true)
+		}
+	}
+	p.print(")")
+	p.line = p.lineOf(rparen)
+}
+
+func (p *printer) printImportDecl(d ImportDecl) {
+	p.print("import ")
+	if !d.lparen.IsValid() {
+		p.printImport(d.Specs[0])
+		return
+	}
+
+	specs := p.sortImports(d.Specs)
+	items := make([]ASTNode, len(specs))
+	for i, s := range specs {
+		items[i] = s
+	}
+	p.printGroup(d.lparen, d.End()-1, items, func(i int) { p.printImport(specs[i]) })
+}
+
+func (p *printer) printImport(s Import) {
+	if s.PackageNickname != "" {
+		p.print(s.PackageNickname + " ")
+	}
+	p.printEscaped(strconv.Quote(s.ImportPath))
+	if g := p.movedComments[s.begin]; g != nil {
+		p.print("\t")
+		p.printEscaped(g.List[0].Text)
+	}
+}
+
+// Sorts each run of imports on consecutive lines by path, like gofmt, and
+// removes duplicates. The sorted imports take the positions of the lines they
+// are moved to, so that they're printed in order, and their trailing comments
+// move with them. Runs with any other comments in them are left alone.
+func (p *printer) sortImports(specs []Import) []Import {
+	var out []Import
+	for len(specs) > 0 {
+		n := 1
+		for n < len(specs) && p.lineOf(specs[n].Begin()) == p.lineOf(specs[n-1].End())+1 {
+			n++
+		}
+		run := append([]Import{}, specs[:n]...)
+		specs = specs[n:]
+
+		comments, ok := p.trailingImportComments(run)
+		if !ok {
+			out = append(out, run...)
+			continue
+		}
+
+		positions := make([][2]lexer.Pos, n)
+		for i, s := range run {
+			positions[i] = [2]lexer.Pos{s.begin, s.end}
+		}
+		sort.SliceStable(run, func(i, j int) bool {
+			if run[i].ImportPath != run[j].ImportPath {
+				return run[i].ImportPath < run[j].ImportPath
+			}
+			return run[i].PackageNickname < run[j].PackageNickname
+		})
+		j := 0
+		for i, s := range run {
+			g := comments[s.begin]
+			if i > 0 && s.ImportPath == run[i-1].ImportPath && s.PackageNickname == run[i-1].PackageNickname && g == nil {
+				continue
+			}
+			s.begin, s.end = positions[j][0], positions[j][1]
+			if g != nil {
+				p.movedComments[s.begin] = g
+				p.skipComments[g] = true
+			}
+			out = append(out, s)
+			j++
+		}
+		if j < n {
+			// The lines of removed duplicates are merged into the last import
+			out[len(out)-1].end = positions[n-1][1]
+		}
+	}
+	return out
+}
+
+// The trailing comment of each import in the run, by position. ok is false if
+// there are comments which aren't single line trailing comments.
+func (p *printer) trailingImportComments(run []Import) (comments map[lexer.Pos]*CommentGroup, ok bool) {
+	comments = make(map[lexer.Pos]*CommentGroup)
+	last := p.lineOf(run[len(run)-1].End())
+	for _, g := range p.comments[p.cindex:] {
+		if g.Begin() < run[0].Begin() {
+			continue
+		} else if p.lineOf(g.Begin()) > last {
+			break
+		}
+		found := false
+		for _, s := range run {
+			if g.Begin() > s.End() && p.lineOf(g.Begin()) == p.lineOf(s.End()) && len(g.List) == 1 && p.lineOf(g.End()) == p.lineOf(s.End()) {
+				comments[s.begin] = g
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return comments, true
+}
+
+func (p *printer) printFuncOrMethodDecl(d FuncOrMethodDecl) {
+	p.print("func ")
+	if d.Receiver != nil {
+		p.printParameterDeclList(*d.Receiver)
+		p.print(" ")
+	}
+	p.print(d.FunctionName.Name)
+	if d.TypeParams != nil {
+		p.printTypeParamList(*d.TypeParams)
+	}
+	p.printFunctionSignature(d.Signature)
+	if d.Body != nil {
+		panic("unimplemented")
+	}
+}
+
+func (p *printer) printTypeDecl(d TypeDecl) {
+	p.print("type ")
+	if !d.lparen.IsValid() {
+		p.printTypeSpec(d.Specs[0], 1)
+		return
+	}
+
+	items := make([]ASTNode, len(d.Specs))
+	for i, s := range d.Specs {
+		items[i] = s
+	}
+	p.printGroup(d.lparen, d.End()-1, items, func(i int) { p.printTypeSpec(d.Specs[i], len(d.Specs)) })
+}
+
+// n is the number of specs in the declaration; the types of grouped specs are aligned.
+func (p *printer) printTypeSpec(s TypeSpec, n int) {
+	p.print(s.Name.Name)
+	if s.TypeParams != nil {
+		p.printTypeParamList(*s.TypeParams)
+	}
+	if n == 1 {
+		p.print(" ")
+	} else {
+		p.print("\v")
+	}
+	if s.IsAlias {
+		p.print("= ")
+	}
+	p.printTypeRef(s.Type)
+}
+
+func (p *printer) printVarDecl(d VarDecl) {
+	p.print("var ")
+	if !d.lparen.IsValid() {
+		p.printVarSpec(d.Specs[0])
+		return
+	}
+
+	items := make([]ASTNode, len(d.Specs))
+	for i, s := range d.Specs {
+		items[i] = s
+	}
+	if len(d.Specs) == 1 {
+		p.printGroup(d.lparen, d.End()-1, items, func(i int) { p.printVarSpec(d.Specs[i]) })
+		return
+	}
+	keepType := keepTypeColumn(d.Specs)
+	p.printGroup(d.lparen, d.End()-1, items, func(i int) { p.printAlignedVarSpec(d.Specs[i], keepType[i]) })
+}
+
+func (p *printer) printVarSpec(s VarSpec) {
+	p.printIdentifierList(s.Names)
+	if s.Type != nil {
+		p.print(" ")
+		p.printTypeRef(s.Type)
+	}
+	if s.Values != nil {
+		p.print(" = ")
+		p.printExprList(s.Values)
+	}
+}
+
+// In a group of var specs the names, types, values and comments are aligned.
+func (p *printer) printAlignedVarSpec(s VarSpec, keepType bool) {
+	p.printIdentifierList(s.Names)
+	extraCells := 3
+	if s.Type != nil || keepType {
+		p.print("\v")
+		extraCells--
+	}
+	if s.Type != nil {
+		p.printTypeRef(s.Type)
+	}
+	if s.Values != nil {
+		p.print("\v= ")
+		p.printExprList(s.Values)
+		extraCells--
+	}
+	p.trailingCells(s.End(), extraCells, "\v")
+}
+
+// Within a run of var specs with values, the type column is kept for all of
+// them if any of them has a type.
+func keepTypeColumn(specs []VarSpec) []bool {
+	m := make([]bool, len(specs))
+	populate := func(i, j int, keepType bool) {
+		if keepType {
+			for ; i < j; i++ {
+				m[i] = true
+			}
+		}
+	}
+
+	i0 := -1 // The start of the current run, if we are in one
+	var keepType bool
+	for i, s := range specs {
+		if s.Values != nil {
+			if i0 < 0 {
+				i0 = i
+				keepType = false
+			}
+		} else if i0 >= 0 {
+			populate(i0, i, keepType)
+			i0 = -1
+		}
+		if s.Type != nil {
+			keepType = true
+		}
+	}
+	if i0 >= 0 {
+		populate(i0, len(specs), keepType)
+	}
+	return m
+}
+
+func (p *printer) printIdentifierList(names []Identifier) {
+	for i, n := range names {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(n.Name)
+	}
+}
+
+func (p *printer) printExprList(exprs []Expr) {
+	for i, e := range exprs {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.printEscaped(e.Text)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Signatures
+
+func (p *printer) printFunctionSignature(sig FunctionSignature) {
+	p.printParameterDeclList(sig.Args)
+	if sig.Return == nil {
+		return
+	}
+	p.print(" ")
+	if r := *sig.Return; len(r.Decls) == 1 && r.Decls[0].Name == nil {
+		// A single unnamed result doesn't need parentheses
+		p.printTypeRef(r.Decls[0].Type)
+	} else {
+		p.printParameterDeclList(r)
+	}
+}
+
+func (p *printer) printParameterDeclList(dl ParameterDeclList) {
+	items := make([]ASTNode, len(dl.Decls))
+	for i, d := range dl.Decls {
+		if d.TypeWasElided {
+			items[i] = *d.Name
+		} else {
+			items[i] = d
+		}
+	}
+	p.printParameters("(", ")", dl.Begin(), dl.End()-1, items, func(i int) {
+		d := dl.Decls[i]
+		if d.Name != nil {
+			p.print(d.Name.Name)
+			if d.TypeWasElided {
+				return
+			}
+			p.print(" ")
+		}
+		p.printTypeRef(d.Type)
+	}, false)
+}
+
+func (p *printer) printTypeParamList(tl TypeParamList) {
+	items := make([]ASTNode, len(tl.Params))
+	for i, tp := range tl.Params {
+		if tp.ConstraintWasElided {
+			items[i] = tp.Name
+		} else {
+			items[i] = tp
+		}
+	}
+	// [P *T,] needs a comma, so that it isn't an array length [P*T]
+	comma := len(tl.Params) == 1 && combinesWithName(tl.Params[0].Constraint)
+	p.printParameters("[", "]", tl.Begin(), tl.End()-1, items, func(i int) {
+		tp := tl.Params[i]
+		p.print(tp.Name.Name)
+		if !tp.ConstraintWasElided {
+			p.print(" ")
+			p.printTypeRef(tp.Constraint)
+		}
+	}, comma)
+}
+
+// Parameters are kept on the lines they are on in the source. If the closing
+// bracket is on its own line, the last parameter is followed by a comma.
+func (p *printer) printParameters(open, close string, lbrack, rbrack lexer.Pos, items []ASTNode, printItem func(i int), comma bool) {
+	p.print(open)
+	prevLine := p.lineOf(lbrack)
+	indented := false
+	for i, item := range items {
+		if i > 0 {
+			p.print(",")
+		}
+		if p.lineOf(item.Begin()) > prevLine {
+			if !indented {
+				p.indent++
+				indented = true
+			}
+			p.line = prevLine
+			p.linebreak(item.Begin(), 0, true)
+		} else if i > 0 {
+			p.print(" ")
+		}
+		printItem(i)
+		prevLine = p.lineOf(item.End())
+	}
+	if len(items) > 0 && p.lineOf(rbrack) > prevLine {
+		p.print(",")
+		if indented {
+			p.indent--
+			indented = false
+		}
+		p.line = prevLine
+		p.linebreak(rbrack, 0, true)
+	} else if comma {
+		p.print(",")
+	}
+	if indented {
+		p.indent--
+	}
+	p.print(close)
+}
+
+// Would "name T" read as the expression name*X or name*X|Y?
+func combinesWithName(t TypeRef) bool {
+	switch t := t.(type) {
+	case PointerTypeRef:
+		return !isTypeElem(t.BaseType)
+	case UnionTypeRef:
+		if t.Terms[0].Tilde || !combinesWithName(t.Terms[0].Type) {
+			return false
+		}
+		for _, term := range t.Terms[1:] {
+			if term.Tilde || isTypeElem(term.Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Is t definitely a type, rather than something which could be an expression?
+func isTypeElem(t TypeRef) bool {
+	switch t.(type) {
+	case ArrayTypeRef, SliceTypeRef, ArrayEllipsesTypeRef, StructTypeRef,
+		FunctionTypeRef, InterfaceTypeRef, MapTypeRef, ChanTypeRef:
+		return true
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Type References
+
+func (p *printer) printTypeRef(t TypeRef) {
+	switch t := t.(type) {
+	case NamedTypeRef:
+		if t.Package != nil {
+			p.print(t.Package.Name + ".")
+		}
+		p.print(t.Name.Name)
+		if t.TypeArgs != nil {
+			p.print("[")
+			for i, arg := range t.TypeArgs {
+				if i > 0 {
+					p.print(", ")
+				}
+				p.printTypeRef(arg)
+			}
+			p.print("]")
+		}
+	case ArrayTypeRef:
+		p.print("[")
+		p.printEscaped(t.Length.Text)
+		p.print("]")
+		p.printTypeRef(t.ElemType)
+	case SliceTypeRef:
+		p.print("[]")
+		p.printTypeRef(t.ElemType)
+	case ArrayEllipsesTypeRef:
+		p.print("[...]")
+		p.printTypeRef(t.ElemType)
+	case PointerTypeRef:
+		p.print("*")
+		p.printTypeRef(t.BaseType)
+	case FunctionTypeRef:
+		p.print("func")
+		p.printFunctionSignature(t.Signature)
+	case MapTypeRef:
+		p.print("map[")
+		p.printTypeRef(t.KeyType)
+		p.print("]")
+		p.printTypeRef(t.ValueType)
+	case ChanTypeRef:
+		switch t.Dir {
+		case ChanSend:
+			p.print("chan<- ")
+		case ChanRecv:
+			p.print("<-chan ")
+		default:
+			p.print("chan ")
+		}
+		if inner, ok := t.Inner.(ChanTypeRef); ok && t.Dir == ChanSendRecv && inner.Dir == ChanRecv {
+			// chan <-chan T would be chan<- chan T
+			p.print("(")
+			p.printTypeRef(inner)
+			p.print(")")
+		} else {
+			p.printTypeRef(t.Inner)
+		}
+	case UnionTypeRef:
+		for i, term := range t.Terms {
+			if i > 0 {
+				p.print(" | ")
+			}
+			if term.Tilde {
+				p.print("~")
+			}
+			p.printTypeRef(term.Type)
+		}
+	case StructTypeRef:
+		p.printStructTypeRef(t)
+	case InterfaceTypeRef:
+		p.printInterfaceTypeRef(t)
+	default:
+		panic("ICE: unknown TypeRef")
+	}
+}
+
+// The printed width of the one-line form of the items, or -1 if it's more than
+// maxSize or doesn't fit on one line.
+func (p *printer) oneLineSize(printIt func(q *printer)) int {
+	const maxSize = 30
+	q := printer{file: p.file}
+	printIt(&q)
+	if q.buf.Len() > maxSize || bytes.ContainsAny(q.buf.Bytes(), "\n\f\t\v") {
+		return -1
+	}
+	return q.buf.Len()
+}
+
+// Can the braces be printed on one line? Single short items are printed as
+// struct{ x int } or interface{ M() } if they are on one line in the source.
+func (p *printer) isOneLine(lbrace, rbrace lexer.Pos, n int, size func() int) bool {
+	if p.lineOf(lbrace) != p.lineOf(rbrace) || p.hasCommentsBetween(lbrace, rbrace) {
+		return false
+	}
+	return n == 0 || (n == 1 && size() >= 0)
+}
+
+func (p *printer) printStructTypeRef(t StructTypeRef) {
+	lbrace, rbrace := t.lbrace, t.End()-1
+	oneLine := p.isOneLine(lbrace, rbrace, len(t.Fields), func() int {
+		f := t.Fields[0]
+		if f.Tag != nil {
+			return -1
+		}
+		return p.oneLineSize(func(q *printer) {
+			if f.Names != nil {
+				q.printIdentifierList(*f.Names)
+				q.print(" ")
+			}
+			q.printTypeRef(f.Type)
+		})
+	})
+	if oneLine {
+		if len(t.Fields) == 0 {
+			p.print("struct{}")
+			return
+		}
+		f := t.Fields[0]
+		p.print("struct{ ")
+		if f.Names != nil {
+			p.printIdentifierList(*f.Names)
+			p.print(" ")
+		}
+		p.printTypeRef(f.Type)
+		p.print(" }")
+		return
+	}
+
+	p.print("struct {")
+	p.line = p.lineOf(lbrace)
+	p.indent++
+
+	sep := "\v"
+	if len(t.Fields) == 1 {
+		sep = " "
+	}
+	start := p.outLines
+	for i, f := range t.Fields {
+		p.linebreak(f.Begin(), 1, i == 0 || p.outLines > start)
+		start = p.outLines
+
+		extraCells := 0
+		if f.Names != nil {
+			p.printIdentifierList(*f.Names)
+			p.print(sep)
+			p.printTypeRef(f.Type)
+			extraCells = 1
+		} else {
+			p.printTypeRef(f.Type)
+			extraCells = 2
+		}
+		if f.Tag != nil {
+			if f.Names != nil && sep == "\v" {
+				p.print(sep)
+			}
+			p.print(sep)
+			p.printEscaped(f.Tag.SourceCode)
+			extraCells = 0
+		}
+		p.trailingCells(f.End(), extraCells, sep)
+		p.line = p.lineOf(f.End())
+	}
+
+	p.closeBrace(rbrace)
+}
+
+func (p *printer) printInterfaceTypeRef(t InterfaceTypeRef) {
+	lbrace, rbrace := t.lbrace, t.End()-1
+	oneLine := p.isOneLine(lbrace, rbrace, len(t.Fields), func() int {
+		return p.oneLineSize(func(q *printer) { q.printInterfaceElem(t.Fields[0]) })
+	})
+	if oneLine {
+		if len(t.Fields) == 0 {
+			p.print("interface{}")
+			return
+		}
+		p.print("interface{ ")
+		p.printInterfaceElem(t.Fields[0])
+		p.print(" }")
+		return
+	}
+
+	p.print("interface {")
+	p.line = p.lineOf(lbrace)
+	p.indent++
+
+	start := p.outLines
+	for i, f := range t.Fields {
+		p.linebreak(f.Begin(), 1, i == 0 || p.outLines > start)
+		start = p.outLines
+		p.printInterfaceElem(f)
+		p.line = p.lineOf(f.End())
+	}
+
+	p.closeBrace(rbrace)
+}
+
+func (p *printer) printInterfaceElem(f ASTNode) {
+	switch f := f.(type) {
+	case InterfaceMethodSpec:
+		p.print(f.MethodName.Name)
+		p.printFunctionSignature(f.Signature)
+	case TypeRef:
+		p.printTypeRef(f)
+	default:
+		panic("ICE: unknown interface element")
+	}
+}
+
+// Prints the "}" of a multi-line struct or interface, after any comments before it.
+func (p *printer) closeBrace(rbrace lexer.Pos) {
+	min := p.flushComments(rbrace, 1)
+	p.indent--
+	p.newlines(min, true)
+	p.print("}")
+	p.line = p.lineOf(rbrace)
+}
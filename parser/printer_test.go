@@ -0,0 +1,163 @@
+package parser
+
+import "bytes"
+import "go/format"
+import t "testing"
+
+// Sources using only the declarations the parser supports. Each is printed
+// and compared against go/format's output for the same source.
+var printerCorpus = []string{
+	"package p\n",
+	"// Package p is documented.\npackage p\n",
+	"// Copyright notice.\n\n// Package p is documented.\npackage p\n\nimport \"fmt\"\n",
+	`package p
+
+import (
+	"strings"
+	"fmt"
+
+	"os"
+	io "io"
+	"fmt"
+)
+
+import . "math"
+
+import _ "embed" // for go:embed
+`,
+	`package p
+
+import (
+	"b" // b
+	"a" // a
+)
+`,
+	"package p\n\nimport (\n\t\"a\"\n\n)\n\nvar (\n\tx int\n\n)\n\ntype (\n\tT int\n\t// c\n\n)\n",
+	"package p\n\nimport (\n\"a\"\n\"a\"\n)\n",
+	"package p\n\nimport (\n\t\"b\"\n\t\"a\"\n\t\"b\"\n\n\t\"c\"\n\t\"c\"\n\n\t\"d\"\n)\n",
+	`package p
+type A int
+type B = A
+type (
+	Short int
+	LongerName []string // comment
+	Alias = map[string]int
+)
+`,
+	`package p
+
+// Point is a point.
+type Point struct {
+	X, Y float64 // coordinates
+	Label string ` + "`json:\"label\"`" + `
+	fmt.Stringer
+	next *Point
+}
+
+type Empty struct{}
+type One struct{ x int }
+type Tagged struct {
+	a   int ` + "`a`" + `
+	bcd string
+}
+`,
+	`package p
+
+type I interface {
+	// M does things.
+	M(a, b int) (c int, err error)
+	N() bool
+	io.Reader
+}
+
+type J interface{ M() }
+type K interface{}
+
+type Number interface {
+	~int | ~int64 | float64
+}
+`,
+	`package p
+
+type List[T any] struct {
+	next *List[T]
+	val  T
+}
+
+type Pair[K comparable, V any] struct{ k K }
+type Map[K, V any] map[K]V
+type Ptr[P *int,] []P
+
+func Keys[K comparable, V any](m map[K]V) []K
+`,
+	`package p
+
+func f()
+func g(a int, b string) (int, error)
+func h(a, b int) int
+func (r *T) Method(x []byte) (n int)
+func k(f func(int) bool, s chan<- int, r <-chan string, c chan (<-chan int)) map[string][]*T
+func long(
+	a int,
+	b string,
+) bool
+`,
+	`package p
+
+var x int
+var y, z = 1, 2
+var (
+	a    int
+	bb   string = "s"
+	c           = 3
+	dddd []int  // comment
+)
+
+var arr [4]int
+var arr2 [N]T
+`,
+	`package p
+
+/* block
+   comment */
+type T int
+
+type U int // trailing
+
+// Free-floating comment.
+
+// Doc for V.
+type V int
+`,
+	"package p\n\n// F does things:\n//go:noinline\n//   - quickly\n//   - quietly\nfunc F()\n",
+	"package p\n\ntype A int; type B int\n",
+	"package p\n\n\n\ntype A int\n\n\n\ntype B int\n",
+	"package p\n\ntype S struct {\n\tA int // a\n\tB string\n\tC int // c\n}\n",
+}
+
+func TestPrinterMatchesGofmt(t *t.T) {
+	for _, src := range printerCorpus {
+		want, err := format.Source([]byte(src))
+		if err != nil {
+			t.Fatalf("gofmt rejected test source: %v\n%s", err, src)
+		}
+		got, err := Format("<test>", []byte(src))
+		if err != nil {
+			t.Fatalf("%v\n%s", err, src)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("source:\n%s\ngot:\n%s\nwant:\n%s", src, got, want)
+		}
+
+		// Printing is idempotent
+		again, err := Format("<test>", got)
+		if err != nil || !bytes.Equal(again, got) {
+			t.Errorf("not idempotent:\n%s\nthen:\n%s", got, again)
+		}
+	}
+}
+
+func TestFormatError(t *t.T) {
+	_, err := Format("<test>", []byte("package p\nfunc (x T) () {}"))
+	assert(t, err != nil && err.Error() == "<test>:2:12 - a function name was expected here")
+}
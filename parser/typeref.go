@@ -12,28 +12,36 @@ type TypeRef interface {
 	_typeRef()
 }
 
-// We are referring to a named type. Either:
-// Identifier | (PackageName "." Identifier)
+// We are referring to a named type, optionally instantiated. Either:
+// Identifier | (PackageName "." Identifier), then [ "[" TypeRef { "," TypeRef } "]" ]
 type NamedTypeRef struct {
-	Package *Identifier // If this is non-nil, this is a qualified type name
-	Name    Identifier
+	Package  *Identifier // If this is non-nil, this is a qualified type name
+	Name     Identifier
+	TypeArgs []TypeRef // If this is non-nil, this is an instantiated generic type
+	end      lexer.Pos
 }
 
-func (o NamedTypeRef) Begin() lexer.Position {
+func (o NamedTypeRef) Begin() lexer.Pos {
 	if o.Package != nil {
 		return o.Package.Begin()
 	} else {
 		return o.Name.Begin()
 	}
 }
-func (o NamedTypeRef) End() lexer.Position     { return o.Name.End() }
+func (o NamedTypeRef) End() lexer.Pos {
+	if o.TypeArgs != nil {
+		return o.end
+	} else {
+		return o.Name.End()
+	}
+}
 func (o NamedTypeRef) _astNode()               {}
 func (o NamedTypeRef) _typeRef()               {}
 func (o NamedTypeRef) _interfaceTypeRefField() {}
 
 func extractIdent(o TypeRef) Identifier {
 	i, ok := o.(NamedTypeRef)
-	if !ok || i.Package != nil {
+	if !ok || i.Package != nil || i.TypeArgs != nil {
 		panic("This isn't an identifier")
 	}
 	return i.Name
@@ -45,95 +53,104 @@ func extractIdentPtr(o TypeRef) *Identifier {
 
 // "[" Expr "]" ElemType
 type ArrayTypeRef struct {
-	begin    lexer.Position
+	begin    lexer.Pos
 	Length   Expr
 	ElemType TypeRef
 }
 
-func (o ArrayTypeRef) Begin() lexer.Position { return o.begin }
-func (o ArrayTypeRef) End() lexer.Position   { return o.ElemType.End() }
-func (o ArrayTypeRef) _astNode()             {}
-func (o ArrayTypeRef) _typeRef()             {}
+func (o ArrayTypeRef) Begin() lexer.Pos { return o.begin }
+func (o ArrayTypeRef) End() lexer.Pos   { return o.ElemType.End() }
+func (o ArrayTypeRef) _astNode()        {}
+func (o ArrayTypeRef) _typeRef()        {}
 
 // "[" "]" ElemType
 type SliceTypeRef struct {
-	begin    lexer.Position
+	begin    lexer.Pos
 	ElemType TypeRef
 }
 
-func (o SliceTypeRef) Begin() lexer.Position { return o.begin }
-func (o SliceTypeRef) End() lexer.Position   { return o.ElemType.End() }
-func (o SliceTypeRef) _astNode()             {}
-func (o SliceTypeRef) _typeRef()             {}
+func (o SliceTypeRef) Begin() lexer.Pos { return o.begin }
+func (o SliceTypeRef) End() lexer.Pos   { return o.ElemType.End() }
+func (o SliceTypeRef) _astNode()        {}
+func (o SliceTypeRef) _typeRef()        {}
 
 // "[" "..." "]" ElemType
 type ArrayEllipsesTypeRef struct {
-	begin    lexer.Position
+	begin    lexer.Pos
 	ElemType TypeRef
 }
 
-func (o ArrayEllipsesTypeRef) Begin() lexer.Position { return o.begin }
-func (o ArrayEllipsesTypeRef) End() lexer.Position   { return o.ElemType.End() }
-func (o ArrayEllipsesTypeRef) _astNode()             {}
-func (o ArrayEllipsesTypeRef) _typeRef()             {}
+func (o ArrayEllipsesTypeRef) Begin() lexer.Pos { return o.begin }
+func (o ArrayEllipsesTypeRef) End() lexer.Pos   { return o.ElemType.End() }
+func (o ArrayEllipsesTypeRef) _astNode()        {}
+func (o ArrayEllipsesTypeRef) _typeRef()        {}
 
 type StructTypeRef struct {
-	begin  lexer.Position
+	begin  lexer.Pos
+	lbrace lexer.Pos
 	Fields []StructTypeRefField
-	end    lexer.Position
+	end    lexer.Pos
 }
 
-func (o StructTypeRef) Begin() lexer.Position { return o.begin }
-func (o StructTypeRef) End() lexer.Position   { return o.end }
-func (o StructTypeRef) _astNode()             {}
-func (o StructTypeRef) _typeRef()             {}
+func (o StructTypeRef) Begin() lexer.Pos { return o.begin }
+func (o StructTypeRef) End() lexer.Pos   { return o.end }
+func (o StructTypeRef) _astNode()        {}
+func (o StructTypeRef) _typeRef()        {}
 
 type StructTypeRefField struct {
+	Doc   *CommentGroup
 	Names *[]Identifier // If not present, anonymous
 	Type  TypeRef
 	Tag   *lexer.Token // If not present, no tag
 }
 
-func (o StructTypeRefField) Begin() lexer.Position {
+func (o StructTypeRefField) Begin() lexer.Pos {
 	if o.Names == nil {
 		return o.Type.Begin()
 	} else {
 		return (*o.Names)[0].Begin()
 	}
 }
-func (o StructTypeRefField) End() lexer.Position { return o.Type.End() }
-func (o StructTypeRefField) _astNode()           {}
+func (o StructTypeRefField) End() lexer.Pos {
+	if o.Tag != nil {
+		return o.Tag.End
+	} else {
+		return o.Type.End()
+	}
+}
+func (o StructTypeRefField) _astNode() {}
 
 type PointerTypeRef struct {
-	begin    lexer.Position
+	begin    lexer.Pos
 	BaseType TypeRef
 }
 
-func (o PointerTypeRef) Begin() lexer.Position { return o.begin }
-func (o PointerTypeRef) End() lexer.Position   { return o.BaseType.End() }
-func (o PointerTypeRef) _astNode()             {}
-func (o PointerTypeRef) _typeRef()             {}
+func (o PointerTypeRef) Begin() lexer.Pos { return o.begin }
+func (o PointerTypeRef) End() lexer.Pos   { return o.BaseType.End() }
+func (o PointerTypeRef) _astNode()        {}
+func (o PointerTypeRef) _typeRef()        {}
 
 type FunctionTypeRef struct {
-	begin     lexer.Position
+	begin     lexer.Pos
 	Signature FunctionSignature
 }
 
-func (o FunctionTypeRef) Begin() lexer.Position { return o.begin }
-func (o FunctionTypeRef) End() lexer.Position   { return o.Signature.End() }
-func (o FunctionTypeRef) _astNode()             {}
-func (o FunctionTypeRef) _typeRef()             {}
+func (o FunctionTypeRef) Begin() lexer.Pos { return o.begin }
+func (o FunctionTypeRef) End() lexer.Pos   { return o.Signature.End() }
+func (o FunctionTypeRef) _astNode()        {}
+func (o FunctionTypeRef) _typeRef()        {}
 
 type InterfaceTypeRef struct {
-	begin  lexer.Position
-	Fields []ASTNode // either InterfaceMethodSpec or NamedTypeRef
-	end    lexer.Position
+	begin  lexer.Pos
+	lbrace lexer.Pos
+	Fields []ASTNode // either InterfaceMethodSpec, NamedTypeRef or UnionTypeRef
+	end    lexer.Pos
 }
 
-func (o InterfaceTypeRef) Begin() lexer.Position { return o.begin }
-func (o InterfaceTypeRef) End() lexer.Position   { return o.end }
-func (o InterfaceTypeRef) _astNode()             {}
-func (o InterfaceTypeRef) _typeRef()             {}
+func (o InterfaceTypeRef) Begin() lexer.Pos { return o.begin }
+func (o InterfaceTypeRef) End() lexer.Pos   { return o.end }
+func (o InterfaceTypeRef) _astNode()        {}
+func (o InterfaceTypeRef) _typeRef()        {}
 
 type InterfaceTypeRefField interface {
 	ASTNode
@@ -141,25 +158,49 @@ type InterfaceTypeRefField interface {
 }
 
 type InterfaceMethodSpec struct {
+	Doc        *CommentGroup
 	MethodName Identifier
 	Signature  FunctionSignature
 }
 
-func (o InterfaceMethodSpec) Begin() lexer.Position   { return o.MethodName.Begin() }
-func (o InterfaceMethodSpec) End() lexer.Position     { return o.Signature.End() }
+func (o InterfaceMethodSpec) Begin() lexer.Pos        { return o.MethodName.Begin() }
+func (o InterfaceMethodSpec) End() lexer.Pos          { return o.Signature.End() }
 func (o InterfaceMethodSpec) _astNode()               {}
 func (o InterfaceMethodSpec) _interfaceTypeRefField() {}
 
+// TypeTerm { "|" TypeTerm }
+// Only valid as an interface element or a type parameter constraint.
+type UnionTypeRef struct {
+	Terms []TypeTerm
+}
+
+func (o UnionTypeRef) Begin() lexer.Pos        { return o.Terms[0].Begin() }
+func (o UnionTypeRef) End() lexer.Pos          { return o.Terms[len(o.Terms)-1].End() }
+func (o UnionTypeRef) _astNode()               {}
+func (o UnionTypeRef) _typeRef()               {}
+func (o UnionTypeRef) _interfaceTypeRefField() {}
+
+// [ "~" ] TypeRef
+type TypeTerm struct {
+	begin lexer.Pos
+	Tilde bool // ~T: any type whose underlying type is T
+	Type  TypeRef
+}
+
+func (o TypeTerm) Begin() lexer.Pos { return o.begin }
+func (o TypeTerm) End() lexer.Pos   { return o.Type.End() }
+func (o TypeTerm) _astNode()        {}
+
 type MapTypeRef struct {
-	begin     lexer.Position
+	begin     lexer.Pos
 	KeyType   TypeRef
 	ValueType TypeRef
 }
 
-func (o MapTypeRef) Begin() lexer.Position { return o.begin }
-func (o MapTypeRef) End() lexer.Position   { return o.ValueType.End() }
-func (o MapTypeRef) _astNode()             {}
-func (o MapTypeRef) _typeRef()             {}
+func (o MapTypeRef) Begin() lexer.Pos { return o.begin }
+func (o MapTypeRef) End() lexer.Pos   { return o.ValueType.End() }
+func (o MapTypeRef) _astNode()        {}
+func (o MapTypeRef) _typeRef()        {}
 
 type ChanDir int
 
@@ -170,7 +211,7 @@ const (
 )
 
 type ChanTypeRef struct {
-	begin lexer.Position
+	begin lexer.Pos
 	Dir   ChanDir
 	Inner TypeRef
 }
@@ -178,21 +219,212 @@ type ChanTypeRef struct {
 func (o ChanTypeRef) IsSend() bool { return o.Dir|ChanSend == ChanSend }
 func (o ChanTypeRef) IsRecv() bool { return o.Dir|ChanRecv == ChanRecv }
 
-func (o ChanTypeRef) Begin() lexer.Position { return o.begin }
-func (o ChanTypeRef) End() lexer.Position   { return o.Inner.End() }
-func (o ChanTypeRef) _astNode()             {}
-func (o ChanTypeRef) _typeRef()             {}
+func (o ChanTypeRef) Begin() lexer.Pos { return o.begin }
+func (o ChanTypeRef) End() lexer.Pos   { return o.Inner.End() }
+func (o ChanTypeRef) _astNode()        {}
+func (o ChanTypeRef) _typeRef()        {}
+
+////////////////////////////////////////////////////////////////////////////////
+// Type Parameters
+
+type TypeParamList struct {
+	begin         lexer.Pos
+	Params        []TypeParam
+	trailingComma bool
+	end           lexer.Pos
+}
+
+func (o TypeParamList) Begin() lexer.Pos { return o.begin }
+func (o TypeParamList) End() lexer.Pos   { return o.end }
+func (o TypeParamList) _astNode()        {}
+
+type TypeParam struct {
+	Name                Identifier
+	ConstraintWasElided bool // [K, V any]: K's constraint is elided
+	Constraint          TypeRef
+}
+
+func (o TypeParam) Begin() lexer.Pos { return o.Name.Begin() }
+func (o TypeParam) End() lexer.Pos   { return o.Constraint.End() }
+func (o TypeParam) _astNode()        {}
+
+/*
+	TypeParameters = "[" TypeParamList [ "," ] "]" .
+	TypeParamList  = TypeParamDecl { "," TypeParamDecl } .
+	TypeParamDecl  = IdentifierList TypeConstraint .
+
+	The "[" has already been consumed. If first is non-nil, so has the first name.
+*/
+func (p *Parser) parseTypeParamList(begin lexer.Pos, first *Identifier) TypeParamList {
+	tl := TypeParamList{begin: begin}
+
+	var names []Identifier
+	if first != nil {
+		names = append(names, *first)
+	} else {
+		names = append(names, p.parseIdentifier())
+	}
+	for {
+		if p.maybe(lexer.Comma) {
+			names = append(names, p.parseIdentifier())
+			continue
+		}
+
+		constraint := p.parseTypeConstraint()
+		for i, name := range names {
+			elided := i != len(names)-1
+			tl.Params = append(tl.Params, TypeParam{Name: name, ConstraintWasElided: elided, Constraint: constraint})
+		}
+		names = nil
+
+		if !p.maybe(lexer.Comma) {
+			break
+		} else if p.peek(lexer.RBracket) {
+			tl.trailingComma = true
+			break
+		}
+		names = append(names, p.parseIdentifier())
+	}
+	p.expect("expected ] at end of type parameters", lexer.RBracket)
+	tl.end = p.t.End
+
+	return tl
+}
+
+// TypeConstraint = TypeElem .
+// A single type without a ~ is returned as is.
+func (p *Parser) parseTypeConstraint() TypeRef {
+	terms := p.parseTypeTerms(nil)
+	if len(terms) == 1 && !terms[0].Tilde {
+		return terms[0].Type
+	}
+	return UnionTypeRef{Terms: terms}
+}
+
+/*
+	TypeElem = TypeTerm { "|" TypeTerm } .
+	TypeTerm = Type | "~" Type .
+
+	If first is non-nil, the first term has already been parsed.
+*/
+func (p *Parser) parseTypeTerms(first *TypeTerm) []TypeTerm {
+	var terms []TypeTerm
+	if first != nil {
+		terms = append(terms, *first)
+	}
+	for first == nil || p.maybe(lexer.BitOrrOp) {
+		first = &TypeTerm{}
+		first.begin = p.peekt.Pos
+		first.Tilde = p.maybe(lexer.TildeOp)
+		first.Type = p.parseTypeRef()
+		terms = append(terms, *first)
+	}
+	return terms
+}
 
+////////////////////////////////////////////////////////////////////////////////
 // Parser
-func (p *Parser) parseTypeRefOrIdent() (TypeRef, bool) {
-	r := p.parseTypeRef()
-	if ntr, ok := r.(NamedTypeRef); ok {
-		if ntr.Package == nil {
-			return r, true
+
+/*
+	In parameter lists and struct fields we don't know whether an identifier is
+	a name or a type until we've seen what follows it. The brackets are awkward:
+		a []T, a [N]T     is a name followed by a slice or array type
+		a[T], a[K, V]     is an instantiated generic type
+
+	Returns:
+		(name, nil)       for a lone identifier, which could be either
+		(name, typeref)   for a name followed by a type
+		(nil, typeref)    for a type
+*/
+func (p *Parser) parseTypeRefOrIdent() (*Identifier, TypeRef) {
+	if !p.peek(lexer.Identifier) {
+		return nil, p.parseTypeRef()
+	}
+
+	name := p.parseIdentifier()
+	if p.peek(lexer.Dot) {
+		return nil, p.parseNamedTypeRef(name)
+	} else if !p.peek(lexer.LBracket) {
+		return &name, nil
+	}
+
+	begin := p.peekt.Pos
+	p.expect("ICE", lexer.LBracket)
+	if p.peek(lexer.RBracket) || p.peek(lexer.EllipsisOp) {
+		return &name, p.parseBracketTypeRef(begin)
+	}
+
+	first := p.maybeParseTypeRef()
+	if first == nil {
+		// Not a type, so it must be an array length
+		return &name, p.parseBracketTypeRef(begin)
+	}
+
+	args := []TypeRef{first}
+	for p.maybe(lexer.Comma) && !p.peek(lexer.RBracket) {
+		args = append(args, p.parseTypeRef())
+	}
+	p.expect("expected ]", lexer.RBracket)
+	end := p.t.End
+
+	if _, ok := first.(NamedTypeRef); ok && len(args) == 1 && p.peekTypeRefStart() {
+		// a [N]T, where N is a named constant
+		inner := p.parseTypeRef()
+		return &name, ArrayTypeRef{begin: begin, Length: namedTypeRefExpr(first.(NamedTypeRef)), ElemType: inner}
+	}
+	return nil, NamedTypeRef{Name: name, TypeArgs: args, end: end}
+}
+
+// Can the next token begin a TypeRef?
+func (p *Parser) peekTypeRefStart() bool {
+	switch p.peekt.Type {
+	case lexer.Identifier, lexer.LParen, lexer.LBracket, lexer.MulOp,
+		lexer.StructKeyword, lexer.FuncKeyword, lexer.InterfaceKeyword,
+		lexer.MapKeyword, lexer.ChanKeyword, lexer.ChanOpOp:
+		return true
+	}
+	return false
+}
+
+// The rest of a NamedTypeRef whose first identifier has already been parsed.
+func (p *Parser) parseNamedTypeRef(first Identifier) NamedTypeRef {
+	var r NamedTypeRef
+	if p.maybe(lexer.Dot) {
+		second := p.parseIdentifier()
+		r = NamedTypeRef{Package: &first, Name: second}
+	} else {
+		r = NamedTypeRef{Name: first}
+	}
+	if p.maybe(lexer.LBracket) { // Instantiation: <[> TypeRef { <,> TypeRef } [<,>] <]>
+		r.TypeArgs = append(r.TypeArgs, p.parseTypeRef())
+		for p.maybe(lexer.Comma) && !p.peek(lexer.RBracket) {
+			r.TypeArgs = append(r.TypeArgs, p.parseTypeRef())
 		}
+		p.expect("expected ] after type arguments", lexer.RBracket)
+		r.end = p.t.End
+	}
+	return r
+}
+
+// <[> <]> TypeRef | <[> <...> <]> TypeRef | <[> Expr <]> TypeRef
+// The "[" has already been consumed.
+func (p *Parser) parseBracketTypeRef(begin lexer.Pos) TypeRef {
+	switch {
+	case p.maybe(lexer.RBracket): // <[> <]> TypeRef
+		inner := p.parseTypeRef()
+		return SliceTypeRef{begin: begin, ElemType: inner}
+	case p.maybe(lexer.EllipsisOp): // <[> <...> <]> TypeRef
+		p.expect("[...] expected", lexer.RBracket)
+		inner := p.parseTypeRef()
+		return ArrayEllipsesTypeRef{begin: begin, ElemType: inner}
+	default: // <[> Expr <]> TypeRef
+		expr := p.parseExpr()
+		p.expect("<[> <expr> <]> expected", lexer.RBracket)
+		inner := p.parseTypeRef()
+		return ArrayTypeRef{begin: begin, Length: expr, ElemType: inner}
 	}
-	return r, false
 }
+
 func (p *Parser) parseTypeRef() TypeRef {
 	r := p.maybeParseTypeRef()
 	if r == nil {
@@ -201,60 +433,49 @@ func (p *Parser) parseTypeRef() TypeRef {
 	return r
 }
 func (p *Parser) maybeParseTypeRef() TypeRef {
-	begin := p.peekt.Position
+	begin := p.peekt.Pos
 	switch {
 	case p.maybe(lexer.LParen): // <(> TypeRef <)>
 		tr := p.parseTypeRef()
 		p.expect("Expected close bracket to match this one", lexer.RParen)
 		return tr
-	case p.peek(lexer.Identifier): // Ident | Ident <.> Ident
+	case p.peek(lexer.Identifier): // Ident | Ident <.> Ident, then [<[> TypeArgs <]>]
 		first := p.parseIdentifier()
-		if p.maybe(lexer.Dot) {
-			second := p.parseIdentifier()
-			return NamedTypeRef{Package: &first, Name: second}
-		} else {
-			return NamedTypeRef{Name: first}
-		}
+		return p.parseNamedTypeRef(first)
 	case p.maybe(lexer.LBracket): // <[> <]> TypeRef | <[> <...> <]> TypeRef | <[> Expr <]> TypeRef
-		switch {
-		case p.maybe(lexer.RBracket): // <[> <]> TypeRef
-			inner := p.parseTypeRef()
-			return SliceTypeRef{begin: begin, ElemType: inner}
-		case p.maybe(lexer.EllipsisOp): // <[> <...> <]> TypeRef
-			p.expect("[...] expected", lexer.RBracket)
-			inner := p.parseTypeRef()
-			return ArrayEllipsesTypeRef{begin: begin, ElemType: inner}
-		default: // <[> Expr <]> TypeRef
-			expr := p.parseExpr()
-			p.expect("<[> <expr> <]> expected", lexer.RBracket)
-			inner := p.parseTypeRef()
-			return ArrayTypeRef{begin: begin, Length: expr, ElemType: inner}
-		}
+		return p.parseBracketTypeRef(begin)
 	case p.maybe(lexer.StructKeyword): // <struct> <{> { FieldDecl <;> } <}>
 		p.expect("{ must occur after a struct keyword", lexer.LBrace)
-		ret := StructTypeRef{begin: begin}
-		ret.begin = p.t.Position
+		ret := StructTypeRef{begin: begin, lbrace: p.t.Pos}
 		for !p.peek(lexer.RBrace) {
 			// FieldDecl = (IdentifierList TypeRef | TypeRef) [Tag]
-			field := StructTypeRefField{}
+			field := StructTypeRefField{Doc: p.peekDoc}
 
-			first, first_ident := p.parseTypeRefOrIdent()
+			name, first := p.parseTypeRefOrIdent()
 
-			if first_ident && !(p.peek(lexer.Semicolon) || p.peek(lexer.RBrace) || p.peek(lexer.RawStringLiteral) || p.peek(lexer.InterpretedStringLiteral)) {
+			if name != nil && first != nil {
+				// FieldDecl = Identifier TypeRef [Tag], where TypeRef begins with <[>
+				field.Names = &[]Identifier{*name}
+				field.Type = first
+			} else if name != nil && !(p.peek(lexer.Semicolon) || p.peek(lexer.RBrace) || p.peek(lexer.RawStringLiteral) || p.peek(lexer.InterpretedStringLiteral)) {
 				// FieldDecl = IdentifierList TypeRef [Tag]
-				names := []Identifier{extractIdent(first)}
+				names := []Identifier{*name}
 				for p.maybe(lexer.Comma) {
 					names = append(names, p.parseIdentifier())
 				}
 				field.Names = &names
 				field.Type = p.parseTypeRef()
+			} else if name != nil {
+				// FieldDecl = TypeRef [Tag], an embedded type
+				field.Type = NamedTypeRef{Name: *name}
 			} else {
 				// FieldDecl = TypeRef [Tag]
 				field.Type = first
 			}
 
 			if p.maybe(lexer.RawStringLiteral) || p.maybe(lexer.InterpretedStringLiteral) {
-				field.Tag = &(p.t)
+				tag := p.t
+				field.Tag = &tag
 			}
 
 			ret.Fields = append(ret.Fields, field)
@@ -262,7 +483,7 @@ func (p *Parser) maybeParseTypeRef() TypeRef {
 			p.expectSemicolon("no semicolon?")
 		}
 		p.expect("expected }", lexer.RBrace)
-		ret.end = p.t.Position
+		ret.end = p.t.End
 		return ret
 	case p.maybe(lexer.MulOp): // <*> TypeRef
 		inner := p.parseTypeRef()
@@ -270,22 +491,31 @@ func (p *Parser) maybeParseTypeRef() TypeRef {
 	case p.maybe(lexer.FuncKeyword): // <func> FunctionSignature
 		sig := p.parseFunctionSignature(false)
 		return FunctionTypeRef{begin: begin, Signature: sig}
-	case p.maybe(lexer.InterfaceKeyword): // <interface> <{> { MethodSpec <;> } <}>
+	case p.maybe(lexer.InterfaceKeyword): // <interface> <{> { InterfaceElem <;> } <}>
 		p.expect("{ expected", lexer.LBrace)
-		ret := InterfaceTypeRef{begin: begin}
+		ret := InterfaceTypeRef{begin: begin, lbrace: p.t.Pos}
 		for !p.peek(lexer.RBrace) {
 			var field InterfaceTypeRefField
 
-			// MethodSpec = MethodName FunctionSignature | TypeName
-			name := p.parseIdentifier()
-			if p.maybe(lexer.Dot) { // MethodSpec = TypeName = QualifiedName = Identifier <.> Identifier
-				name2 := p.parseIdentifier()
-				field = NamedTypeRef{Package: &name, Name: name2}
-			} else if p.peek(lexer.LParen) { // MethodSpec = MethodName FunctionSignature
-				sig := p.parseFunctionSignature(false)
-				field = InterfaceMethodSpec{MethodName: name, Signature: sig}
-			} else { // MethodSpec = TypeName = Identifier
-				field = NamedTypeRef{Name: name}
+			// InterfaceElem = MethodName FunctionSignature | TypeElem
+			doc := p.peekDoc
+			var first *TypeTerm
+			if p.peek(lexer.Identifier) {
+				name := p.parseIdentifier()
+				if p.peek(lexer.LParen) { // InterfaceElem = MethodName FunctionSignature
+					sig := p.parseFunctionSignature(false)
+					field = InterfaceMethodSpec{Doc: doc, MethodName: name, Signature: sig}
+				} else { // InterfaceElem = TypeElem, starting with a TypeName
+					first = &TypeTerm{begin: name.Begin(), Type: p.parseNamedTypeRef(name)}
+				}
+			}
+			if field == nil { // InterfaceElem = TypeElem = TypeTerm { <|> TypeTerm }
+				terms := p.parseTypeTerms(first)
+				if ntr, ok := terms[0].Type.(NamedTypeRef); ok && len(terms) == 1 && !terms[0].Tilde {
+					field = ntr // An embedded interface
+				} else {
+					field = UnionTypeRef{Terms: terms}
+				}
 			}
 
 			ret.Fields = append(ret.Fields, field)
@@ -293,7 +523,7 @@ func (p *Parser) maybeParseTypeRef() TypeRef {
 			p.expectSemicolon("expect ; at end of methodspec")
 		}
 		p.expect("expected }", lexer.RBrace)
-		ret.end = p.t.Position
+		ret.end = p.t.End
 		return ret
 	case p.maybe(lexer.MapKeyword): // <map> <[> TypeRef <]> TypeRef
 		p.expect("[ expected", lexer.LBracket)
@@ -0,0 +1,450 @@
+package parser
+
+import "github.com/MerryMage/agi/lexer"
+import "fmt"
+
+////////////////////////////////////////////////////////////////////////////////
+// Walk
+//   Traverses an AST depth-first, in source order.
+//
+//   Doc comments are visited as *CommentGroup, followed by their Comments.
+//   Directives, File.Imports and File.Comments are derived from other nodes
+//   and aren't visited. A type or constraint which is shared by several names,
+//   as in (a, b int) or [K, V any], is only visited once, after the last name.
+
+// Visit is called for each node. If it returns a non-nil Visitor w, the
+// children of the node are walked with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node ASTNode) (w Visitor)
+}
+
+func Walk(v Visitor, node ASTNode) {
+	var stack []Visitor
+	pre := func(c *Cursor) bool {
+		w := v
+		if len(stack) > 0 {
+			w = stack[len(stack)-1]
+		}
+		if w = w.Visit(c.Node()); w == nil {
+			return false
+		}
+		stack = append(stack, w)
+		return true
+	}
+	post := func(c *Cursor) bool {
+		w := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		w.Visit(nil)
+		return true
+	}
+	Apply(node, pre, post)
+}
+
+type inspector func(ASTNode) bool
+
+func (f inspector) Visit(node ASTNode) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Calls f for each node. If f returns true, the children of the node are
+// inspected, followed by a call of f(nil).
+func Inspect(node ASTNode, f func(ASTNode) bool) {
+	Walk(inspector(f), node)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Apply
+//   Traverses an AST like Walk, with a Cursor which allows the current node to
+//   be replaced, or deleted or added to if it's in a list.
+//
+//   The AST is made of values, so Apply returns the new root: each node whose
+//   children have changed is copied with the new children. File.Imports is
+//   rebuilt from the new ImportDecls.
+
+// If pre returns false, the children of the node are skipped and post isn't
+// called for it. If post returns false, Apply stops visiting nodes.
+type ApplyFunc func(*Cursor) bool
+
+type Cursor struct {
+	parent ASTNode
+	name   string
+	iter   *iterator // Non-nil if the node is in a list
+	node   ASTNode
+
+	// Changes to the list around the node
+	deleted bool
+	after   []ASTNode
+	before  []ASTNode
+}
+
+type iterator struct {
+	index int
+}
+
+// The current node.
+func (c *Cursor) Node() ASTNode { return c.node }
+
+// The parent of the current node, as it was before its children were visited.
+func (c *Cursor) Parent() ASTNode { return c.parent }
+
+// The name of the parent's field which contains the current node.
+func (c *Cursor) Name() string { return c.name }
+
+// The index of the current node in its list, or -1 if it's not in a list.
+func (c *Cursor) Index() int {
+	if c.iter == nil {
+		return -1
+	}
+	return c.iter.index
+}
+
+// Replaces the current node. Its children are visited, rather than the old
+// node's, but pre isn't called for the replacement.
+func (c *Cursor) Replace(n ASTNode) {
+	if c.deleted {
+		panic("Cursor.Replace: the node has been deleted")
+	}
+	c.node = n
+}
+
+// Deletes the current node from its list.
+func (c *Cursor) Delete() {
+	if c.iter == nil {
+		panic(fmt.Sprintf("Cursor.Delete: %s is not a list", c.name))
+	}
+	c.deleted = true
+}
+
+// Inserts n into the list after the current node. It isn't visited.
+func (c *Cursor) InsertAfter(n ASTNode) {
+	if c.iter == nil {
+		panic(fmt.Sprintf("Cursor.InsertAfter: %s is not a list", c.name))
+	}
+	c.after = append([]ASTNode{n}, c.after...)
+}
+
+// Inserts n into the list before the current node. It isn't visited.
+func (c *Cursor) InsertBefore(n ASTNode) {
+	if c.iter == nil {
+		panic(fmt.Sprintf("Cursor.InsertBefore: %s is not a list", c.name))
+	}
+	c.before = append(c.before, n)
+}
+
+type applier struct {
+	pre, post ApplyFunc
+	stopped   bool
+}
+
+func Apply(root ASTNode, pre, post ApplyFunc) ASTNode {
+	a := applier{pre: pre, post: post}
+	return a.apply(nil, "", nil, root).node
+}
+
+// Calls pre, visits the children of n, then calls post. The returned cursor
+// holds the new node and any changes to the list it's in.
+func (a *applier) apply(parent ASTNode, name string, iter *iterator, n ASTNode) *Cursor {
+	c := &Cursor{parent: parent, name: name, iter: iter, node: n}
+	if a.stopped {
+		return c
+	}
+	if a.pre != nil && !a.pre(c) || c.deleted {
+		return c
+	}
+	c.node = a.children(c.node)
+	if a.post != nil && !a.stopped && !a.post(c) {
+		a.stopped = true
+	}
+	return c
+}
+
+// Applies to a single child, which must be replaced by a node of the same type.
+func applyNode[T ASTNode](a *applier, parent ASTNode, name string, n T) T {
+	c := a.apply(parent, name, nil, n)
+	r, ok := c.node.(T)
+	if !ok {
+		panic(fmt.Sprintf("Apply: %T can't be used as %s of %T", c.node, name, parent))
+	}
+	return r
+}
+
+// Applies to each element of a list, which may be replaced, deleted or added to.
+func applyList[T ASTNode](a *applier, parent ASTNode, name string, list []T) []T {
+	out, _ := applyListFrom(a, parent, name, list)
+	return out
+}
+
+// Like applyList, but also returns the index in list of each element of the
+// new list, or -1 for an inserted element.
+func applyListFrom[T ASTNode](a *applier, parent ASTNode, name string, list []T) ([]T, []int) {
+	if list == nil {
+		return nil, nil
+	}
+	out := make([]T, 0, len(list))
+	from := make([]int, 0, len(list))
+	add := func(n ASTNode, index int) {
+		r, ok := n.(T)
+		if !ok {
+			panic(fmt.Sprintf("Apply: %T can't be used in %s of %T", n, name, parent))
+		}
+		out = append(out, r)
+		from = append(from, index)
+	}
+
+	iter := &iterator{}
+	for i, n := range list {
+		c := a.apply(parent, name, iter, n)
+		for _, b := range c.before {
+			add(b, -1)
+		}
+		if !c.deleted {
+			add(c.node, i)
+		}
+		for _, b := range c.after {
+			add(b, -1)
+		}
+		iter.index = len(out)
+	}
+	return out, from
+}
+
+// Whether the i'th element of a new list, whose type was elided, still shares
+// its type with the next element: both must come from the same run of
+// elements with a shared type in the old list. elided reports whether each
+// element of the old list had its type elided.
+func stillElided(from []int, i int, elided func(int) bool) bool {
+	if i+1 >= len(from) || from[i] < 0 || from[i+1] <= from[i] {
+		return false
+	}
+	for j := from[i]; j < from[i+1]; j++ {
+		if !elided(j) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *applier) children(n ASTNode) ASTNode {
+	switch x := n.(type) {
+	case File:
+		x.Doc = a.doc(x, x.Doc)
+		x.ImportDecls = applyList(a, x, "ImportDecls", x.ImportDecls)
+		x.Imports = nil
+		for _, d := range x.ImportDecls {
+			x.Imports = append(x.Imports, d.Specs...)
+		}
+		x.Decls = applyList(a, x, "Decls", x.Decls)
+		return x
+	case ImportDecl:
+		x.Doc = a.doc(x, x.Doc)
+		x.Specs = applyList(a, x, "Specs", x.Specs)
+		return x
+	case Import, Identifier, Expr, Comment:
+		return x
+
+	case *CommentGroup:
+		list := applyList(a, x, "List", x.List)
+		if len(list) != len(x.List) {
+			return &CommentGroup{list}
+		}
+		for i := range list {
+			if list[i] != x.List[i] {
+				return &CommentGroup{list}
+			}
+		}
+		return x
+
+	case FuncOrMethodDecl:
+		x.Doc = a.doc(x, x.Doc)
+		if x.Receiver != nil {
+			recv := applyNode(a, x, "Receiver", *x.Receiver)
+			x.Receiver = &recv
+		}
+		x.FunctionName = applyNode(a, x, "FunctionName", x.FunctionName)
+		if x.TypeParams != nil {
+			tps := applyNode(a, x, "TypeParams", *x.TypeParams)
+			x.TypeParams = &tps
+		}
+		x.Signature = applyNode(a, x, "Signature", x.Signature)
+		return x
+	case TypeDecl:
+		x.Doc = a.doc(x, x.Doc)
+		x.Specs = applyList(a, x, "Specs", x.Specs)
+		return x
+	case TypeSpec:
+		x.Doc = a.doc(x, x.Doc)
+		x.Name = applyNode(a, x, "Name", x.Name)
+		if x.TypeParams != nil {
+			tps := applyNode(a, x, "TypeParams", *x.TypeParams)
+			x.TypeParams = &tps
+		}
+		x.Type = applyNode(a, x, "Type", x.Type)
+		return x
+	case VarDecl:
+		x.Doc = a.doc(x, x.Doc)
+		x.Specs = applyList(a, x, "Specs", x.Specs)
+		return x
+	case VarSpec:
+		x.Doc = a.doc(x, x.Doc)
+		x.Names = applyList(a, x, "Names", x.Names)
+		if x.Type != nil {
+			x.Type = applyNode(a, x, "Type", x.Type)
+		}
+		x.Values = applyList(a, x, "Values", x.Values)
+		return x
+
+	case FunctionSignature:
+		x.Args = applyNode(a, x, "Args", x.Args)
+		if x.Return != nil {
+			ret := applyNode(a, x, "Return", *x.Return)
+			x.Return = &ret
+		}
+		return x
+	case ParameterDeclList:
+		old := x.Decls
+		var from []int
+		x.Decls, from = applyListFrom(a, x, "Decls", x.Decls)
+		// Elided types are the same as the next parameter's, unless the list
+		// has changed around them
+		for i := len(x.Decls) - 1; i >= 0; i-- {
+			if !x.Decls[i].TypeWasElided {
+				continue
+			}
+			if stillElided(from, i, func(j int) bool { return old[j].TypeWasElided }) {
+				x.Decls[i].Type = x.Decls[i+1].Type
+			} else {
+				x.Decls[i].TypeWasElided = false
+			}
+		}
+		return x
+	case ParameterDecl:
+		if x.Name != nil {
+			name := applyNode(a, x, "Name", *x.Name)
+			x.Name = &name
+		}
+		if !x.TypeWasElided {
+			x.Type = applyNode(a, x, "Type", x.Type)
+		}
+		return x
+	case TypeParamList:
+		old := x.Params
+		var from []int
+		x.Params, from = applyListFrom(a, x, "Params", x.Params)
+		for i := len(x.Params) - 1; i >= 0; i-- {
+			if !x.Params[i].ConstraintWasElided {
+				continue
+			}
+			if stillElided(from, i, func(j int) bool { return old[j].ConstraintWasElided }) {
+				x.Params[i].Constraint = x.Params[i+1].Constraint
+			} else {
+				x.Params[i].ConstraintWasElided = false
+			}
+		}
+		return x
+	case TypeParam:
+		x.Name = applyNode(a, x, "Name", x.Name)
+		if !x.ConstraintWasElided {
+			x.Constraint = applyNode(a, x, "Constraint", x.Constraint)
+		}
+		return x
+
+	case NamedTypeRef:
+		if x.Package != nil {
+			pkg := applyNode(a, x, "Package", *x.Package)
+			x.Package = &pkg
+		}
+		x.Name = applyNode(a, x, "Name", x.Name)
+		x.TypeArgs = applyList(a, x, "TypeArgs", x.TypeArgs)
+		return x
+	case ArrayTypeRef:
+		x.Length = applyNode(a, x, "Length", x.Length)
+		x.ElemType = applyNode(a, x, "ElemType", x.ElemType)
+		return x
+	case SliceTypeRef:
+		x.ElemType = applyNode(a, x, "ElemType", x.ElemType)
+		return x
+	case ArrayEllipsesTypeRef:
+		x.ElemType = applyNode(a, x, "ElemType", x.ElemType)
+		return x
+	case StructTypeRef:
+		x.Fields = applyList(a, x, "Fields", x.Fields)
+		return x
+	case StructTypeRefField:
+		x.Doc = a.doc(x, x.Doc)
+		if x.Names != nil {
+			names := applyList(a, x, "Names", *x.Names)
+			x.Names = &names
+		}
+		x.Type = applyNode(a, x, "Type", x.Type)
+		return x
+	case PointerTypeRef:
+		x.BaseType = applyNode(a, x, "BaseType", x.BaseType)
+		return x
+	case FunctionTypeRef:
+		x.Signature = applyNode(a, x, "Signature", x.Signature)
+		return x
+	case InterfaceTypeRef:
+		x.Fields = applyList(a, x, "Fields", x.Fields)
+		return x
+	case InterfaceMethodSpec:
+		x.Doc = a.doc(x, x.Doc)
+		x.MethodName = applyNode(a, x, "MethodName", x.MethodName)
+		x.Signature = applyNode(a, x, "Signature", x.Signature)
+		return x
+	case UnionTypeRef:
+		x.Terms = applyList(a, x, "Terms", x.Terms)
+		return x
+	case TypeTerm:
+		x.Type = applyNode(a, x, "Type", x.Type)
+		return x
+	case MapTypeRef:
+		x.KeyType = applyNode(a, x, "KeyType", x.KeyType)
+		x.ValueType = applyNode(a, x, "ValueType", x.ValueType)
+		return x
+	case ChanTypeRef:
+		x.Inner = applyNode(a, x, "Inner", x.Inner)
+		return x
+	}
+	panic(fmt.Sprintf("ICE: Apply: unknown node %T", n))
+}
+
+func (a *applier) doc(parent ASTNode, g *CommentGroup) *CommentGroup {
+	if g == nil {
+		return nil
+	}
+	return applyNode(a, parent, "Doc", g)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Lookup by position
+
+// The innermost node containing pos, followed by each of its ancestors up to
+// and including root.
+func PathTo(root ASTNode, pos lexer.Pos) []ASTNode {
+	// Every node is entered, since doc comments are outside of their parent
+	var path, stack []ASTNode
+	Inspect(root, func(n ASTNode) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		stack = append(stack, n)
+		if len(stack) == 1 || len(stack) > len(path) && n.Begin() <= pos && pos < n.End() {
+			path = append(path[:0], stack...)
+		}
+		return true
+	})
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// The innermost node containing pos.
+func NodeAt(root ASTNode, pos lexer.Pos) ASTNode {
+	return PathTo(root, pos)[0]
+}
@@ -0,0 +1,232 @@
+package parser
+
+import "github.com/MerryMage/agi/lexer"
+import "fmt"
+import "strings"
+import t "testing"
+
+const walkSrc = `package p
+
+// T is generic.
+type T[K, V any] struct {
+	m map[K]V
+}
+
+func f(a, b int) *T[int, string]
+`
+
+func TestInspect(t *t.T) {
+	f := getParser(walkSrc).ParseFile()
+
+	var names []string
+	depth, maxDepth := 0, 0
+	Inspect(f, func(n ASTNode) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		if i, ok := n.(Identifier); ok {
+			names = append(names, i.Name)
+		}
+		return true
+	})
+	assert(t, depth == 0)
+	assert(t, maxDepth == 9) // File FuncOrMethodDecl FunctionSignature ParameterDeclList ParameterDecl PointerTypeRef NamedTypeRef NamedTypeRef Identifier
+	// Elided types and constraints are only visited once
+	assert(t, strings.Join(names, " ") == "T K V any m K V f a b int T int string")
+
+	// Pruning
+	var kinds []string
+	Inspect(f, func(n ASTNode) bool {
+		if n != nil {
+			kinds = append(kinds, fmt.Sprintf("%T", n))
+		}
+		_, isDecl := n.(Decl)
+		return !isDecl
+	})
+	assert(t, strings.Join(kinds, " ") == "parser.File parser.TypeDecl parser.FuncOrMethodDecl")
+}
+
+type countingVisitor struct {
+	entered, left *int
+}
+
+func (v countingVisitor) Visit(n ASTNode) Visitor {
+	if n == nil {
+		*v.left++
+	} else {
+		*v.entered++
+	}
+	return v
+}
+
+func TestWalk(t *t.T) {
+	f := getParser(walkSrc).ParseFile()
+	entered, left := 0, 0
+	Walk(countingVisitor{&entered, &left}, f)
+	assert(t, entered > 0 && entered == left)
+}
+
+func TestApply(t *t.T) {
+	src := "package p\n\ntype A int\ntype B int\ntype C int\n"
+	f := getParser(src).ParseFile()
+
+	// Rename every identifier A to Renamed, delete B, and add D after C
+	g := Apply(f, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case Identifier:
+			if n.Name == "A" {
+				c.Replace(Identifier{n.pos, "Renamed"})
+			}
+		case TypeDecl:
+			switch n.Specs[0].Name.Name {
+			case "B":
+				assert(t, c.Name() == "Decls" && c.Index() == 1)
+				c.Delete()
+			case "C":
+				assert(t, c.Index() == 1)
+				d := n
+				d.Specs = []TypeSpec{n.Specs[0]}
+				d.Specs[0].Name.Name = "D"
+				c.InsertAfter(d)
+			}
+		}
+		return true
+	}, nil).(File)
+
+	var names []string
+	for _, d := range g.Decls {
+		names = append(names, d.(TypeDecl).Specs[0].Name.Name)
+	}
+	assert(t, strings.Join(names, " ") == "Renamed C D")
+	// The original is unchanged
+	assert(t, len(f.Decls) == 3 && f.Decls[0].(TypeDecl).Specs[0].Name.Name == "A")
+
+	// The imports are kept up to date
+	h := Apply(getParser("package p\n\nimport (\n\t\"a\"\n\t\"b\"\n)\n").ParseFile(), func(c *Cursor) bool {
+		if i, ok := c.Node().(Import); ok && i.ImportPath == "a" {
+			c.Delete()
+		}
+		return true
+	}, nil).(File)
+	assert(t, len(h.Imports) == 1 && h.Imports[0].ImportPath == "b")
+
+	// Replacing a node with one of the wrong type
+	shouldPanic(t, func() {
+		Apply(f, func(c *Cursor) bool {
+			if _, ok := c.Node().(Identifier); ok {
+				c.Replace(Expr{})
+			}
+			return true
+		}, nil)
+	})
+
+	// Only list elements can be deleted
+	shouldPanic(t, func() {
+		Apply(f, func(c *Cursor) bool {
+			if _, ok := c.Node().(Identifier); ok {
+				c.Delete()
+			}
+			return true
+		}, nil)
+	})
+
+	// Stopping early
+	n := 0
+	Apply(f, nil, func(c *Cursor) bool {
+		n++
+		return false
+	})
+	assert(t, n == 1)
+}
+
+// Changing a list of parameters which share a type keeps the right types.
+func TestApplyElided(t *t.T) {
+	params := func(src string, f ApplyFunc) string {
+		file := Apply(getParser("package p\n\nfunc f"+src+"\n").ParseFile(), f, nil).(File)
+		var out []string
+		for _, d := range file.Decls[0].(FuncOrMethodDecl).Signature.Args.Decls {
+			s := d.Name.Name
+			if !d.TypeWasElided {
+				s += " " + d.Type.(NamedTypeRef).Name.Name
+			}
+			out = append(out, s)
+		}
+		return strings.Join(out, ", ")
+	}
+	named := func(n ASTNode, name string) bool {
+		d, ok := n.(ParameterDecl)
+		return ok && d.Name.Name == name
+	}
+
+	assert(t, params("(a, b int)", func(c *Cursor) bool {
+		if named(c.Node(), "b") {
+			c.Delete()
+		}
+		return true
+	}) == "a int")
+	assert(t, params("(a, b, c int)", func(c *Cursor) bool {
+		if named(c.Node(), "b") {
+			c.Delete()
+		}
+		return true
+	}) == "a, c int")
+	assert(t, params("(a, b int, c string)", func(c *Cursor) bool {
+		if named(c.Node(), "b") {
+			c.Delete()
+		}
+		return true
+	}) == "a int, c string")
+	assert(t, params("(a, b int)", func(c *Cursor) bool {
+		if named(c.Node(), "a") {
+			d := c.Node().(ParameterDecl)
+			d.Name = &Identifier{Name: "x"}
+			d.TypeWasElided = false
+			d.Type = NamedTypeRef{Name: Identifier{Name: "string"}}
+			c.InsertAfter(d)
+		}
+		return true
+	}) == "a int, x string, b int")
+
+	// A shared type which is replaced is still shared
+	assert(t, params("(a, b int)", func(c *Cursor) bool {
+		if id, ok := c.Node().(Identifier); ok && id.Name == "int" {
+			c.Replace(Identifier{id.pos, "uint"})
+		}
+		return true
+	}) == "a, b uint")
+
+	// The same goes for type parameters
+	g := Apply(getParser("package p\n\ntype T[K, V any] int\n").ParseFile(), func(c *Cursor) bool {
+		if p, ok := c.Node().(TypeParam); ok && p.Name.Name == "V" {
+			c.Delete()
+		}
+		return true
+	}, nil).(File)
+	tps := g.Decls[0].(TypeDecl).Specs[0].TypeParams.Params
+	assert(t, len(tps) == 1 && !tps[0].ConstraintWasElided)
+}
+
+func TestPathTo(t *t.T) {
+	f := getParser(walkSrc).ParseFile()
+	at := func(s string, i int) string {
+		pos := f.Begin() + lexer.Pos(strings.Index(walkSrc, s)+i)
+		var kinds []string
+		for _, n := range PathTo(f, pos) {
+			kinds = append(kinds, strings.Replace(fmt.Sprintf("%T", n), "parser.", "", 1))
+		}
+		return strings.Join(kinds, " ")
+	}
+
+	assert(t, at("map[K]V", 4) == "Identifier NamedTypeRef MapTypeRef StructTypeRefField StructTypeRef TypeSpec TypeDecl File")
+	assert(t, at("V any", 0) == "Identifier TypeParam TypeParamList TypeSpec TypeDecl File")
+	assert(t, at("is generic", 0) == "Comment *CommentGroup TypeDecl File")
+	assert(t, at("b int", 0) == "Identifier ParameterDecl ParameterDeclList FunctionSignature FuncOrMethodDecl File")
+	assert(t, at("\n\n//", 0) == "File")
+	_, ok := NodeAt(f, f.Begin()).(File)
+	assert(t, ok)
+}